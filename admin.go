@@ -0,0 +1,300 @@
+package topd
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/felicson/topd/internal/activity"
+	"github.com/felicson/topd/internal/config"
+	"github.com/felicson/topd/internal/log"
+	"github.com/felicson/topd/internal/metrics"
+	"github.com/felicson/topd/internal/sign"
+	"github.com/felicson/topd/storage"
+)
+
+const adminSitesPath = "/sites/"
+
+// maxDomainsBody limits request body of domains update
+const maxDomainsBody = 64 << 10
+
+// FlushReporter provides result of the last storage flush
+type FlushReporter interface {
+	LastFlush() (time.Time, error)
+}
+
+// Admin serves dashboard for ops and support
+type Admin struct {
+	siteMap *storage.SiteAggregate
+	history *storage.HistoryCollector
+	flush   FlushReporter
+	recent  *activity.Recent
+	reload  func() error
+	live    http.HandlerFunc // streams hits of a site, see Web.LiveServer
+	config  config.Admin
+	logger  log.Logger
+}
+
+type dashboard struct {
+	Sites     []storage.SiteStat
+	Pending   int
+	LastFlush time.Time
+	FlushErr  error
+	// shares of bot requests among all hits and all events
+	HitBotRate   float64
+	EventBotRate float64
+}
+
+type siteDashboard struct {
+	Site storage.SiteStat
+	Hits []activity.Hit
+}
+
+var adminTemplates = template.Must(template.New("layout").Funcs(template.FuncMap{
+	"percent": func(f float64) string { return strconv.FormatFloat(f*100, 'f', 2, 64) + "%" },
+	"time":    func(t time.Time) string { return t.Format("2006-01-02 15:04:05") },
+}).Parse(`{{define "header"}}<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>topd</title>
+<style>body{font-family:sans-serif;margin:2em}table{border-collapse:collapse}td,th{border:1px solid #ccc;padding:2px 8px;text-align:left}.num{text-align:right}.err{color:#c00}</style>
+</head><body>{{end}}
+{{define "footer"}}</body></html>{{end}}
+
+{{define "index"}}{{template "header"}}
+<h1>topd</h1>
+<p>Pending rows: {{.Pending}}<br>
+Last flush: {{if .LastFlush.IsZero}}never{{else}}{{time .LastFlush}}{{end}}{{if .FlushErr}} <span class="err">{{.FlushErr}}</span>{{end}}<br>
+Bot rejection rate: hits {{percent .HitBotRate}}, events {{percent .EventBotRate}}</p>
+<table>
+<tr><th>Site</th><th>Counter</th><th>Hits</th><th>Hosts</th><th>Opted out</th></tr>
+{{range .Sites}}<tr><td><a href="/sites/{{.ID}}">{{.ID}}</a></td><td class="num">{{.CounterID}}</td><td class="num">{{.Hits}}</td><td class="num">{{.Hosts}}</td><td class="num">{{.OptedOut}}</td></tr>
+{{end}}</table>
+{{template "footer"}}{{end}}
+
+{{define "site"}}{{template "header"}}
+<p><a href="/">&larr; sites</a></p>
+<h1>Site {{.Site.ID}}</h1>
+<p>Hits: {{.Site.Hits}}, hosts: {{.Site.Hosts}}, opted out: {{.Site.OptedOut}}<br>
+Domains: {{range $i, $d := .Site.Domains}}{{if $i}}, {{end}}{{$d}}{{else}}any{{end}}</p>
+{{if .Site.Goals}}<h2>Goals</h2><table>{{range $name, $count := .Site.Goals}}<tr><td>{{$name}}</td><td class="num">{{$count}}</td></tr>{{end}}</table>{{end}}
+{{if .Site.Events}}<h2>Events</h2><table>{{range $name, $count := .Site.Events}}<tr><td>{{$name}}</td><td class="num">{{$count}}</td></tr>{{end}}</table>{{end}}
+<h2>Recent hits</h2>
+<table>
+<tr><th>Time</th><th>Page</th><th>Referrer</th><th>Country</th><th>Bot</th></tr>
+{{range .Hits}}<tr><td>{{time .Date}}</td><td>{{.Page}}</td><td>{{.Referrer}}</td><td>{{.Country}}</td><td>{{if .Bot}}yes{{end}}</td></tr>
+{{end}}</table>
+{{template "footer"}}{{end}}`))
+
+// auth allows requests with valid basic auth credentials or bearer token
+func (a *Admin) auth(next http.HandlerFunc) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		if a.config.Token != "" {
+			token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(a.config.Token)) == 1 {
+				next(w, req)
+				return
+			}
+		}
+		if a.config.User != "" {
+			user, password, ok := req.BasicAuth()
+			if ok &&
+				subtle.ConstantTimeCompare([]byte(user), []byte(a.config.User)) == 1 &&
+				subtle.ConstantTimeCompare([]byte(password), []byte(a.config.Password)) == 1 {
+				next(w, req)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="topd"`)
+		}
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	}
+}
+
+// IndexServer lists all sites with today counters
+func (a *Admin) IndexServer(w http.ResponseWriter, req *http.Request) {
+
+	if req.URL.Path != "/" {
+		NotFound(w, req)
+		return
+	}
+
+	d := dashboard{
+		Sites:   a.siteMap.List(),
+		Pending: a.history.Pending(),
+	}
+	d.LastFlush, d.FlushErr = a.flush.LastFlush()
+	d.HitBotRate, d.EventBotRate = botRates()
+	a.render(w, "index", d)
+}
+
+// botRates returns bot rejection rates of hits and events, each path is divided by its own
+// processed requests which include the rejected ones
+func botRates() (float64, float64) {
+	rate := func(rejected, total float64) float64 {
+		if total == 0 {
+			return 0
+		}
+		return rejected / total
+	}
+	return rate(metrics.Value(metrics.BotRejections.WithLabelValues("hit")), metrics.Value(metrics.Hits)),
+		rate(metrics.Value(metrics.BotRejections.WithLabelValues("event")), metrics.Value(metrics.Events))
+}
+
+// SiteServer shows site counters and the latest hits on /sites/{id},
+// site actions are served on /sites/{id}/{action}
+func (a *Admin) SiteServer(w http.ResponseWriter, req *http.Request) {
+
+	path, action := strings.TrimPrefix(req.URL.Path, adminSitesPath), ""
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		path, action = path[:i], path[i+1:]
+	}
+	siteID, err := strconv.Atoi(path)
+	if err != nil {
+		NotFound(w, req)
+		return
+	}
+	site, ok := a.siteMap.Get(siteID)
+	if !ok {
+		NotFound(w, req)
+		return
+	}
+
+	switch action {
+	case "":
+		a.render(w, "site", siteDashboard{Site: site.Stat(), Hits: a.recent.List(siteID)})
+	case "domains":
+		a.domains(w, req, site)
+	case "secret":
+		a.secret(w, req, site)
+	case "sign":
+		a.sign(w, req, site)
+	default:
+		NotFound(w, req)
+	}
+}
+
+// domains replaces allowed domains of the site with JSON array from PUT request body
+func (a *Admin) domains(w http.ResponseWriter, req *http.Request, site *storage.Site) {
+
+	if req.Method != http.MethodPut {
+		w.Header().Set("Allow", "PUT")
+		a.writeJSON(w, http.StatusMethodNotAllowed, apiError{Error: http.StatusText(http.StatusMethodNotAllowed)})
+		return
+	}
+
+	var domains []string
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxDomainsBody)).Decode(&domains); err != nil {
+		a.writeJSON(w, http.StatusBadRequest, apiError{Error: err.Error()})
+		return
+	}
+	if err := a.siteMap.SetDomains(site.ID, domains); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, storage.ErrWrongDomain) {
+			status = http.StatusBadRequest
+		} else {
+			a.logger.Error(err)
+		}
+		a.writeJSON(w, status, apiError{Error: err.Error()})
+		return
+	}
+	a.writeJSON(w, http.StatusOK, site.Stat())
+}
+
+type secretResult struct {
+	Secret string `json:"secret,omitempty"`
+}
+
+// secret rotates site secret on POST and removes signature requirement on DELETE
+func (a *Admin) secret(w http.ResponseWriter, req *http.Request, site *storage.Site) {
+
+	var (
+		result secretResult
+		err    error
+	)
+	switch req.Method {
+	case http.MethodPost:
+		result.Secret, err = a.siteMap.RotateSecret(site.ID)
+	case http.MethodDelete:
+		err = a.siteMap.RemoveSecret(site.ID)
+	default:
+		w.Header().Set("Allow", "POST, DELETE")
+		a.writeJSON(w, http.StatusMethodNotAllowed, apiError{Error: http.StatusText(http.StatusMethodNotAllowed)})
+		return
+	}
+	if err != nil {
+		a.logger.Error(err)
+		a.writeJSON(w, http.StatusInternalServerError, apiError{Error: err.Error()})
+		return
+	}
+	a.writeJSON(w, http.StatusOK, result)
+}
+
+type signResult struct {
+	Sig   string `json:"sig"`
+	Query string `json:"query"`
+}
+
+// sign issues signature for counter parameters of the request query: /sites/{id}/sign?mode=pixel
+func (a *Admin) sign(w http.ResponseWriter, req *http.Request, site *storage.Site) {
+
+	query := req.URL.Query()
+	query.Set("id", strconv.Itoa(site.ID))
+	sign.Stamp(query, time.Now())
+
+	sig, err := site.Sign(query)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, storage.ErrNoSecret) {
+			status = http.StatusConflict
+		}
+		a.writeJSON(w, status, apiError{Error: err.Error()})
+		return
+	}
+	query.Set(sign.Param, sig)
+	a.writeJSON(w, http.StatusOK, signResult{Sig: sig, Query: query.Encode()})
+}
+
+// ReloadServer applies changed configuration, bots list and counter images on POST
+func (a *Admin) ReloadServer(w http.ResponseWriter, req *http.Request) {
+
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		a.writeJSON(w, http.StatusMethodNotAllowed, apiError{Error: http.StatusText(http.StatusMethodNotAllowed)})
+		return
+	}
+	if err := a.reload(); err != nil {
+		a.logger.Error(err)
+		a.writeJSON(w, http.StatusInternalServerError, apiError{Error: err.Error()})
+		return
+	}
+	a.writeJSON(w, http.StatusOK, readiness{Status: "ok"})
+}
+
+func (a *Admin) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	if err := writeJSON(w, status, v); err != nil {
+		a.logger.Error(err)
+	}
+}
+
+func (a *Admin) render(w http.ResponseWriter, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := adminTemplates.ExecuteTemplate(w, name, data); err != nil {
+		a.logger.Error(err)
+	}
+}
+
+func (a *Admin) mux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", a.auth(a.IndexServer))
+	mux.HandleFunc(adminSitesPath, a.auth(a.SiteServer))
+	mux.HandleFunc("/reload", a.auth(a.ReloadServer))
+	if a.live != nil {
+		mux.HandleFunc("/live/", a.auth(a.live))
+	}
+	return mux
+}
@@ -0,0 +1,142 @@
+package topd
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/felicson/topd/internal/config"
+	"github.com/felicson/topd/internal/sign"
+	"github.com/felicson/topd/storage"
+)
+
+type flushStub struct{}
+
+func (flushStub) LastFlush() (time.Time, error) {
+	return time.Now(), errors.New("storage is down")
+}
+
+func TestAdmin(t *testing.T) {
+	web := newTestWeb(t)
+	history := storage.NewHistoryCollector(&storage.HistoryBuffer{}, 1)
+
+	admin := Admin{
+		siteMap: web.siteMap,
+		history: &history,
+		flush:   flushStub{},
+		recent:  web.recent,
+		live:    web.LiveServer,
+		config:  config.Admin{User: "admin", Password: "secret", Token: "token"},
+		logger:  web.logger,
+	}
+	handler := admin.mux()
+
+	req := httptest.NewRequest(http.MethodGet, "/top/?id=1&fw=1&p=https://example.com/<b>", nil)
+	web.ErrHandler(web.TopServer)(httptest.NewRecorder(), req)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+		t.Fatalf("expected basic auth challenge, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/live/?id=1", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("live stream without credentials: unexpected status %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.SetBasicAuth("admin", "secret")
+	handler.ServeHTTP(rec, req)
+	if body := rec.Body.String(); rec.Code != http.StatusOK || !strings.Contains(body, "storage is down") || !strings.Contains(body, `href="/sites/2"`) {
+		t.Errorf("unexpected index %d: %s", rec.Code, body)
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/sites/1", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	handler.ServeHTTP(rec, req)
+	if body := rec.Body.String(); rec.Code != http.StatusOK || !strings.Contains(body, "https://example.com/&lt;b&gt;") {
+		t.Errorf("unexpected site page %d: %s", rec.Code, body)
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPut, "/sites/2/domains", strings.NewReader(`["example.com", "*.example.org"]`))
+	req.Header.Set("Authorization", "Bearer token")
+	handler.ServeHTTP(rec, req)
+	if body := rec.Body.String(); rec.Code != http.StatusOK || !strings.Contains(body, `"Domains":["example.com","example.org"]`) {
+		t.Errorf("unexpected domains update %d: %s", rec.Code, body)
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPut, "/sites/2/domains", strings.NewReader(`["exa mple.com"]`))
+	req.Header.Set("Authorization", "Bearer token")
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("wrong domain: unexpected status %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/sites/2/sign?mode=pixel", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("sign without secret: unexpected status %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/sites/2/secret", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	handler.ServeHTTP(rec, req)
+	var secret secretResult
+	if err := json.NewDecoder(rec.Body).Decode(&secret); err != nil || rec.Code != http.StatusOK || len(secret.Secret) != 64 {
+		t.Fatalf("unexpected secret rotation %d %+v %v", rec.Code, secret, err)
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/sites/2/sign?mode=pixel", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	handler.ServeHTTP(rec, req)
+	var signed signResult
+	if err := json.NewDecoder(rec.Body).Decode(&signed); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("unexpected sign response %d %v", rec.Code, err)
+	}
+	query, _ := url.ParseQuery(signed.Query)
+	if !sign.Verify(secret.Secret, query, time.Now(), time.Minute) || query.Get("id") != "2" {
+		t.Errorf("issued signature is not valid: %+v", signed)
+	}
+}
+
+func TestBotRates(t *testing.T) {
+	web := newTestWeb(t)
+	bot := "Mozilla/5.0 (Windows NT 6.1; WOW64) AppleWebKit/534+ (KHTML, like Gecko) BingPreview/1.0b"
+	send := func(handler http.HandlerFunc, path string) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("User-Agent", bot)
+		handler(httptest.NewRecorder(), req)
+	}
+
+	// rejected events do not change the hits rate
+	send(web.ErrHandler(web.TopServer), "/top/?id=1&fw=1&mode=beacon")
+	hitRate, eventRate := botRates()
+	send(web.EventServer, "/event/?id=1&name=signup")
+	if hits, events := botRates(); hits != hitRate || events <= eventRate {
+		t.Errorf("bot event: unexpected rates %v %v, was %v %v", hits, events, hitRate, eventRate)
+	}
+
+	hitRate, eventRate = botRates()
+	send(web.ErrHandler(web.TopServer), "/top/?id=1&fw=1&mode=beacon")
+	if hits, events := botRates(); hits <= hitRate || events != eventRate {
+		t.Errorf("bot hit: unexpected rates %v %v, was %v %v", hits, events, hitRate, eventRate)
+	}
+	if hits, events := botRates(); hits > 1 || events > 1 {
+		t.Errorf("rates over 100%%: %v %v", hits, events)
+	}
+}
@@ -0,0 +1,92 @@
+package topd
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/felicson/topd/storage"
+)
+
+const apiSitesPath = "/api/sites/"
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// apiSite is the public part of site counters, settings and events stay on the admin listener
+type apiSite struct {
+	ID        int
+	CounterID int
+	Hits      int
+	Hosts     int
+	Digits    bool
+}
+
+func newAPISite(stat storage.SiteStat) apiSite {
+	return apiSite{
+		ID:        stat.ID,
+		CounterID: stat.CounterID,
+		Hits:      stat.Hits,
+		Hosts:     stat.Hosts,
+		Digits:    stat.Digits,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) error {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(v)
+}
+
+func (web *Web) apiError(w http.ResponseWriter, status int) {
+	if err := writeJSON(w, status, apiError{Error: http.StatusText(status)}); err != nil {
+		web.logger.Error(err)
+	}
+}
+
+// readOnly allows only GET and HEAD requests
+func (web *Web) readOnly(next http.HandlerFunc) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			web.apiError(w, http.StatusMethodNotAllowed)
+			return
+		}
+		next(w, req)
+	}
+}
+
+// SitesServer returns current counters of all sites
+func (web *Web) SitesServer(w http.ResponseWriter, _ *http.Request) {
+	stats := web.siteMap.List()
+	sites := make([]apiSite, 0, len(stats))
+	for _, stat := range stats {
+		sites = append(sites, newAPISite(stat))
+	}
+	if err := writeJSON(w, http.StatusOK, sites); err != nil {
+		web.logger.Error(err)
+	}
+}
+
+// SiteServer returns current counters of the site from /api/sites/{id}
+func (web *Web) SiteServer(w http.ResponseWriter, req *http.Request) {
+
+	siteID, err := strconv.Atoi(strings.TrimPrefix(req.URL.Path, apiSitesPath))
+	if err != nil {
+		web.apiError(w, http.StatusNotFound)
+		return
+	}
+
+	site, ok := web.siteMap.Get(siteID)
+	if !ok {
+		web.apiError(w, http.StatusNotFound)
+		return
+	}
+	if err := writeJSON(w, http.StatusOK, newAPISite(site.Stat())); err != nil {
+		web.logger.Error(err)
+	}
+}
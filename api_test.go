@@ -0,0 +1,74 @@
+package topd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSiteServer(t *testing.T) {
+	web := newTestWeb(t)
+	site, _ := web.siteMap.Get(2)
+	site.Increment(true, true)
+
+	rec := httptest.NewRecorder()
+	web.readOnly(web.SiteServer)(rec, httptest.NewRequest(http.MethodGet, "/api/sites/2", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d", rec.Code)
+	}
+	var stat map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&stat); err != nil {
+		t.Fatal(err)
+	}
+	if stat["ID"] != 2.0 || stat["Hits"] != 1.0 || stat["Hosts"] != 1.0 {
+		t.Errorf("unexpected stat %+v", stat)
+	}
+	// domains, signature, opt-outs, events and goals are not public
+	if len(stat) != 5 || stat["CounterID"] == nil || stat["Digits"] == nil {
+		t.Errorf("unexpected fields %+v", stat)
+	}
+
+	for path, status := range map[string]int{"/api/sites/100": http.StatusNotFound, "/api/sites/x": http.StatusNotFound} {
+		rec = httptest.NewRecorder()
+		web.SiteServer(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != status {
+			t.Errorf("%s: expected %d, got %d", path, status, rec.Code)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	web.readOnly(web.SiteServer)(rec, httptest.NewRequest(http.MethodPost, "/api/sites/2", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", rec.Code)
+	}
+}
+
+func TestSitesServer(t *testing.T) {
+	web := newTestWeb(t)
+	if err := web.siteMap.SetDomains(1, []string{"example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	site, _ := web.siteMap.Get(1)
+	site.TrackEvent("signup")
+
+	rec := httptest.NewRecorder()
+	web.SitesServer(rec, httptest.NewRequest(http.MethodGet, "/api/sites", nil))
+
+	var stats []map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 || stats[0]["ID"] != 1.0 || stats[1]["ID"] != 2.0 {
+		t.Errorf("unexpected sites %+v", stats)
+	}
+	for _, stat := range stats {
+		for key := range stat {
+			switch key {
+			case "ID", "CounterID", "Hits", "Hosts", "Digits":
+			default:
+				t.Errorf("site %v: unexpected field %s", stat["ID"], key)
+			}
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"time"
+
 	"github.com/felicson/topd/internal/keeper"
 	"github.com/felicson/topd/internal/log"
 	"github.com/felicson/topd/storage"
@@ -10,8 +12,10 @@ type keeperD struct {
 	siteCollection *storage.SiteAggregate
 	sessionPerSite *storage.SessionsPerSite
 	logger         log.Logger
-	topData        *storage.TopDataCollection
+	history        *storage.HistoryBuffer
 	storage        storage.Storage
+	location       *time.Location
+	resetMode      string
 }
 
 func (k *keeperD) GetSessionCleaner() keeper.SessionCleaner {
@@ -30,6 +34,18 @@ func (k *keeperD) GetStorage() keeper.Saver {
 	return k.storage
 }
 
-func (k *keeperD) GetTopData() *storage.TopDataCollection {
-	return k.topData
+func (k *keeperD) GetResetLog() keeper.ResetLog {
+	return k.storage
+}
+
+func (k *keeperD) GetHistory() keeper.History {
+	return k.history
+}
+
+func (k *keeperD) GetLocation() *time.Location {
+	return k.location
+}
+
+func (k *keeperD) GetResetMode() string {
+	return k.resetMode
 }
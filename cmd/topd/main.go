@@ -5,17 +5,23 @@ import (
 	"flag"
 	"fmt"
 	stdlog "log"
+	"time"
 
 	"github.com/felicson/topd"
 	"github.com/felicson/topd/image"
 	"github.com/felicson/topd/internal/bot"
 	"github.com/felicson/topd/internal/config"
 	"github.com/felicson/topd/internal/keeper"
+	"github.com/felicson/topd/internal/metrics"
+	"github.com/felicson/topd/internal/referrer"
 	"github.com/felicson/topd/storage"
 	"github.com/felicson/topd/storage/mysql"
 	"go.uber.org/zap"
 )
 
+// historyQueue is default number of hits and events waiting for the history collector
+const historyQueue = 4096
+
 func main() {
 
 	var (
@@ -26,18 +32,21 @@ func main() {
 	flag.StringVar(&confFlag, "conf", "config.yml", "conf path")
 	flag.Parse()
 
-	conf, err := config.NewConfig(confFlag, envFlag)
+	load := func() (config.Config, error) {
+		return config.NewConfig(confFlag, envFlag)
+	}
+	conf, err := load()
 	if err != nil {
 		stdlog.Fatalf("on parse conf: %v", err)
 	}
 
-	if err := run(conf); err != nil {
+	if err := run(conf, load); err != nil {
 		stdlog.Fatal(err)
 	}
 
 }
 
-func run(config config.Config) error {
+func run(config config.Config, load func() (config.Config, error)) error {
 
 	level, err := zap.ParseAtomicLevel(config.LogLevel)
 	if err != nil {
@@ -61,6 +70,13 @@ func run(config config.Config) error {
 		return fmt.Errorf("on build bot checker: %v", err)
 	}
 
+	var referrers *referrer.Blocklist
+	if config.ReferrerList != "" {
+		if referrers, err = referrer.NewBlocklistFromFile(config.ReferrerList); err != nil {
+			return fmt.Errorf("on build referrer blocklist: %v", err)
+		}
+	}
+
 	images, err := image.NewImages(config.ImagesPath)
 	if err != nil {
 		return fmt.Errorf("on build images: %v", err)
@@ -73,39 +89,76 @@ func run(config config.Config) error {
 	}
 	defer store.Close()
 
-	ctx := context.Background()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	siteMap := storage.NewSiteAggregate(store, images)
-	siteMap.Init()
+	siteMap := storage.NewSiteAggregate(store)
+	if err := siteMap.Init(); err != nil {
+		logger.Error(err)
+	}
 
 	sps := storage.NewSessionPerSite()
 
 	done := make(chan struct{}, 1)
 	defer close(done)
 
-	var topDataCollection storage.TopDataCollection
+	var history storage.HistoryBuffer
+
+	location, err := time.LoadLocation(config.DatabaseLocation)
+	if err != nil {
+		return fmt.Errorf("on load location: %v", err)
+	}
 
 	kd := keeperD{
 		siteCollection: &siteMap,
 		sessionPerSite: sps,
 		logger:         logger,
-		topData:        &topDataCollection,
+		history:        &history,
 		storage:        store,
+		location:       location,
+		resetMode:      config.DailyReset,
 	}
 
 	kpr, _ := keeper.New(&kd)
 	go kpr.Run(ctx, done)
 
-	hCollector := storage.NewHistoryCollector(&topDataCollection, 10)
+	queue := config.HistoryQueue
+	if queue <= 0 {
+		queue = historyQueue
+	}
+	hCollector := storage.NewHistoryCollector(&history, queue)
 	hCollector.Run(ctx)
 
+	metrics.HitsQueueLength.Set(func() float64 {
+		return float64(hCollector.Len())
+	})
+	metrics.HitsQueueCapacity.Set(func() float64 {
+		return float64(hCollector.Cap())
+	})
+	metrics.EventsQueueLength.Set(func() float64 {
+		return float64(hCollector.EventsLen())
+	})
+	metrics.EventsQueueCapacity.Set(func() float64 {
+		return float64(hCollector.EventsCap())
+	})
+
 	deps := webApp{
 		config:         config,
 		siteCollection: &siteMap,
 		sessionPerSite: sps,
 		logger:         logger,
-		historyWriter:  hCollector,
+		historyWriter:  &hCollector,
 		botChecker:     &bChecker,
+		referrers:      referrers,
+		images:         images,
+		healthChecks: []topd.HealthCheck{
+			{Name: "storage", Check: store.Ping},
+			{Name: "history_collector", Check: hCollector.Ready},
+			{Name: "keeper", Check: kpr.Ready},
+		},
+		flushReporter: &kpr,
+		configLoader:  load,
+		logLevel:      logLevel{zapConf.Level},
 	}
 
 	logger.Info("running topd")
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"github.com/felicson/topd"
+	"github.com/felicson/topd/image"
 	"github.com/felicson/topd/internal/bot"
 	"github.com/felicson/topd/internal/config"
 	"github.com/felicson/topd/internal/log"
+	"github.com/felicson/topd/internal/referrer"
 	"github.com/felicson/topd/storage"
+	"go.uber.org/zap"
 )
 
 type webApp struct {
@@ -12,8 +16,33 @@ type webApp struct {
 	siteCollection *storage.SiteAggregate
 	sessionPerSite *storage.SessionsPerSite
 	logger         log.Logger
-	historyWriter  storage.HistoryCollector
+	historyWriter  *storage.HistoryCollector
 	botChecker     *bot.Checker
+	referrers      *referrer.Blocklist
+	images         image.ImageList
+	healthChecks   []topd.HealthCheck
+	flushReporter  topd.FlushReporter
+	configLoader   func() (config.Config, error)
+	logLevel       topd.LogLevel
+}
+
+// logLevel sets level of zap logger by name
+type logLevel struct {
+	level zap.AtomicLevel
+}
+
+func (l logLevel) Check(level string) error {
+	_, err := zap.ParseAtomicLevel(level)
+	return err
+}
+
+func (l logLevel) Set(level string) error {
+	parsed, err := zap.ParseAtomicLevel(level)
+	if err != nil {
+		return err
+	}
+	l.level.SetLevel(parsed.Level())
+	return nil
 }
 
 func (wa *webApp) GetLogger() log.Logger {
@@ -33,9 +62,33 @@ func (wa *webApp) GetSessionPerSite() *storage.SessionsPerSite {
 }
 
 func (wa *webApp) GetHistoryWriter() *storage.HistoryCollector {
-	return &wa.historyWriter
+	return wa.historyWriter
 }
 
 func (wa *webApp) GetBotChecker() *bot.Checker {
 	return wa.botChecker
 }
+
+func (wa *webApp) GetReferrerBlocklist() *referrer.Blocklist {
+	return wa.referrers
+}
+
+func (wa *webApp) GetImages() image.ImageList {
+	return wa.images
+}
+
+func (wa *webApp) GetHealthChecks() []topd.HealthCheck {
+	return wa.healthChecks
+}
+
+func (wa *webApp) GetFlushReporter() topd.FlushReporter {
+	return wa.flushReporter
+}
+
+func (wa *webApp) GetConfigLoader() func() (config.Config, error) {
+	return wa.configLoader
+}
+
+func (wa *webApp) GetLogLevel() topd.LogLevel {
+	return wa.logLevel
+}
@@ -0,0 +1,70 @@
+// Command topsign issues signed counter urls and secrets for sites requiring signature
+package main
+
+import (
+	"flag"
+	"fmt"
+	stdlog "log"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/felicson/topd/internal/sign"
+)
+
+func main() {
+
+	var (
+		secretFlag string
+		idFlag     int
+		modeFlag   string
+		formatFlag string
+		hostFlag   string
+		newFlag    bool
+	)
+	flag.StringVar(&secretFlag, "secret", "", "site secret, hex encoded")
+	flag.IntVar(&idFlag, "id", 0, "site id")
+	flag.StringVar(&modeFlag, "mode", "", "counter mode: image, pixel or beacon, live signs the public live stream url")
+	flag.StringVar(&formatFlag, "format", "", "counter format: png or svg")
+	flag.StringVar(&hostFlag, "host", "", "counter host, query is printed when empty")
+	flag.BoolVar(&newFlag, "new", false, "generate new secret and exit")
+	flag.Parse()
+
+	if newFlag {
+		secret, err := sign.NewSecret()
+		if err != nil {
+			stdlog.Fatal(err)
+		}
+		fmt.Println(secret)
+		return
+	}
+
+	if secretFlag == "" || idFlag <= 0 {
+		flag.Usage()
+		stdlog.Fatal("secret and id are required")
+	}
+
+	query := url.Values{"id": {strconv.Itoa(idFlag)}}
+	if modeFlag != "" {
+		query.Set("mode", modeFlag)
+	}
+	if formatFlag != "" {
+		query.Set("format", formatFlag)
+	}
+	sign.Stamp(query, time.Now())
+	sig, err := sign.Sign(secretFlag, query)
+	if err != nil {
+		stdlog.Fatalf("on sign: %v", err)
+	}
+	query.Set(sign.Param, sig)
+
+	if hostFlag == "" {
+		fmt.Println(query.Encode())
+		return
+	}
+	path := "top"
+	if modeFlag == "live" {
+		path = "live"
+	}
+	fmt.Printf("https://%s/%s/?%s\n", hostFlag, path, query.Encode())
+}
@@ -0,0 +1,163 @@
+package topd
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/felicson/topd/internal/metrics"
+	"github.com/felicson/topd/storage"
+)
+
+const (
+	maxCollectBody   = 1 << 20
+	maxCollectEvents = 100
+	maxSessionLen    = 16
+	maxEventAge      = 24 * time.Hour
+	maxEventSkew     = time.Minute
+)
+
+var (
+	errUnknownSite     = errors.New("unknown site")
+	errEmptyPage       = errors.New("empty page")
+	errWrongPage       = errors.New("wrong page url")
+	errWrongSession    = errors.New("wrong session")
+	errWrongTimestamp  = errors.New("timestamp out of range")
+	errWrongSignature  = errors.New("wrong signature")
+	errTooManyEvents   = errors.New("too many events")
+	errMalformedEvents = errors.New("malformed events")
+)
+
+// collectEvent is a single hit of the batch, timestamp in unix milliseconds
+type collectEvent struct {
+	SiteID    int    `json:"site_id"`
+	Page      string `json:"page"`
+	Referrer  string `json:"referrer"`
+	Timestamp int64  `json:"timestamp"`
+	Session   string `json:"session,omitempty"`
+}
+
+type collectError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+type collectResult struct {
+	Accepted int            `json:"accepted"`
+	Rejected int            `json:"rejected"`
+	Errors   []collectError `json:"errors,omitempty"`
+}
+
+// CollectServer accepts JSON array of hits sent by navigator.sendBeacon,
+// hits of sites with a secret require signed query: /collect?id=1&ts=...&sig=...
+func (web *Web) CollectServer(w http.ResponseWriter, req *http.Request) {
+
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		web.apiError(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	var events []collectEvent
+
+	body := http.MaxBytesReader(w, req.Body, maxCollectBody)
+	if err := json.NewDecoder(body).Decode(&events); err != nil {
+		if err := writeJSON(w, http.StatusBadRequest, apiError{Error: errMalformedEvents.Error()}); err != nil {
+			web.logger.Error(err)
+		}
+		return
+	}
+	if len(events) > maxCollectEvents {
+		if err := writeJSON(w, http.StatusRequestEntityTooLarge, apiError{Error: errTooManyEvents.Error()}); err != nil {
+			web.logger.Error(err)
+		}
+		return
+	}
+
+	var result collectResult
+	now := time.Now()
+	query := req.URL.Query()
+
+	for i := range events {
+		event := &events[i]
+		site, err := web.validateEvent(req, event, query, now)
+		if err != nil {
+			result.Rejected++
+			result.Errors = append(result.Errors, collectError{Index: i, Error: err.Error()})
+			continue
+		}
+
+		sess, ip := web.visitor(req, site)
+		data := storage.RawTopData{
+			Page:      event.Page,
+			Referrer:  event.Referrer,
+			XGeo:      req.Header.Get("X-Geo"),
+			Session:   sess,
+			UserAgent: req.UserAgent(),
+			IP:        ip,
+			SiteID:    event.SiteID,
+		}
+		data.Flags = web.rateFlags(req, site) | web.domainFlags(req, site, data.Page)
+		// client session is kept in history only, hosts are counted by cookie or visitor hash
+		if event.Session != "" && !web.cookieless(req, site) {
+			data.Session = event.Session
+		}
+		if event.Timestamp != 0 {
+			data.Date = time.Unix(0, event.Timestamp*int64(time.Millisecond))
+		}
+
+		web.track(web.state(req), site, data, sess, web.optOut(req, site))
+		result.Accepted++
+	}
+
+	if err := writeJSON(w, http.StatusOK, result); err != nil {
+		web.logger.Error(err)
+	}
+}
+
+func (web *Web) validateEvent(req *http.Request, event *collectEvent, query url.Values, now time.Time) (*storage.Site, error) {
+
+	site, ok := web.siteMap.Get(event.SiteID)
+	if !ok {
+		metrics.UnknownSites.Inc()
+		return nil, errUnknownSite
+	}
+	// signature issued for another site does not match the event site id
+	query.Set("id", strconv.Itoa(event.SiteID))
+	if !web.verifySignature(req, site, query) {
+		return nil, errWrongSignature
+	}
+	if event.Page == "" {
+		return nil, errEmptyPage
+	}
+	if u, err := url.Parse(event.Page); err != nil || u.Host == "" {
+		return nil, errWrongPage
+	}
+	if !validSession(event.Session) {
+		return nil, errWrongSession
+	}
+	if event.Timestamp != 0 {
+		ts := time.Unix(0, event.Timestamp*int64(time.Millisecond))
+		if ts.Before(now.Add(-maxEventAge)) || ts.After(now.Add(maxEventSkew)) {
+			return nil, errWrongTimestamp
+		}
+	}
+	return site, nil
+}
+
+// validSession accepts empty or alphanumeric session up to storage column size
+func validSession(session string) bool {
+	if len(session) > maxSessionLen {
+		return false
+	}
+	for i := 0; i < len(session); i++ {
+		c := session[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
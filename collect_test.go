@@ -0,0 +1,66 @@
+package topd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollectServer(t *testing.T) {
+	web := newTestWeb(t)
+
+	ts := strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+	body := `[
+		{"site_id": 1, "page": "https://example.com/a", "referrer": "https://google.com/", "timestamp": ` + ts + `},
+		{"site_id": 1, "page": "https://example.com/b", "session": "abc123"},
+		{"site_id": 100, "page": "https://example.com/"},
+		{"site_id": 2, "page": ""},
+		{"site_id": 2, "page": "https://example.com/", "timestamp": 1000},
+		{"site_id": 2, "page": "https://example.com/", "session": "bad session"}
+	]`
+	req := httptest.NewRequest(http.MethodPost, "/collect", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	web.CollectServer(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d", rec.Code)
+	}
+	var result collectResult
+	if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Accepted != 2 || result.Rejected != 4 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	expected := map[int]string{
+		2: errUnknownSite.Error(),
+		3: errEmptyPage.Error(),
+		4: errWrongTimestamp.Error(),
+		5: errWrongSession.Error(),
+	}
+	for _, e := range result.Errors {
+		if expected[e.Index] != e.Error {
+			t.Errorf("event %d: expected %q, got %q", e.Index, expected[e.Index], e.Error)
+		}
+	}
+
+	stat, _ := web.siteMap.Get(1)
+	// client session does not make a new host
+	if s := stat.Stat(); s.Hits != 2 || s.Hosts != 1 {
+		t.Errorf("unexpected counters %+v", s)
+	}
+	rows := web.historyWriter.(*historyRecorder).rows
+	if len(rows) != 2 || rows[0].Session != "192.0.2.1" || rows[1].Session != "abc123" {
+		t.Errorf("unexpected history %+v", rows)
+	}
+
+	rec = httptest.NewRecorder()
+	web.CollectServer(rec, httptest.NewRequest(http.MethodPost, "/collect", strings.NewReader("{")))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", rec.Code)
+	}
+}
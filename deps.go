@@ -1,9 +1,11 @@
 package topd
 
 import (
+	"github.com/felicson/topd/image"
 	"github.com/felicson/topd/internal/bot"
 	"github.com/felicson/topd/internal/config"
 	"github.com/felicson/topd/internal/log"
+	"github.com/felicson/topd/internal/referrer"
 	"github.com/felicson/topd/storage"
 )
 
@@ -14,4 +16,10 @@ type Deps interface {
 	GetSessionPerSite() *storage.SessionsPerSite
 	GetHistoryWriter() *storage.HistoryCollector
 	GetBotChecker() *bot.Checker
+	GetReferrerBlocklist() *referrer.Blocklist
+	GetImages() image.ImageList
+	GetHealthChecks() []HealthCheck
+	GetFlushReporter() FlushReporter
+	GetConfigLoader() func() (config.Config, error)
+	GetLogLevel() LogLevel
 }
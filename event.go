@@ -0,0 +1,73 @@
+package topd
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/felicson/topd/internal/metrics"
+	"github.com/felicson/topd/storage"
+)
+
+// EventServer records custom event: /event/?id=1&name=purchase&value=9.99&p=page
+func (web *Web) EventServer(w http.ResponseWriter, req *http.Request) {
+
+	if req.Method != http.MethodGet && req.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		web.apiError(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	siteID, _ := strconv.Atoi(req.FormValue("id"))
+	site, ok := web.siteMap.Get(siteID)
+	if !ok {
+		metrics.UnknownSites.Inc()
+		web.apiError(w, http.StatusNotFound)
+		return
+	}
+	if !web.verifySignature(req, site, req.Form) {
+		web.apiError(w, http.StatusForbidden)
+		return
+	}
+
+	name := req.FormValue("name")
+	if !storage.ValidEventName(name) {
+		web.apiError(w, http.StatusBadRequest)
+		return
+	}
+
+	event := storage.Event{
+		SiteID: siteID,
+		Name:   name,
+		Page:   truncate(req.FormValue("p"), 255),
+	}
+	event.Sess, _ = web.visitor(req, site)
+
+	if v := req.FormValue("value"); v != "" {
+		value, err := strconv.ParseFloat(v, 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			web.apiError(w, http.StatusBadRequest)
+			return
+		}
+		event.Value = &value
+	}
+
+	switch web.optOut(req, site) {
+	case storage.OptOutIgnore:
+		if err := web.historyWriter.WriteEvent(event); err != nil {
+			web.logger.Error(err)
+		}
+	case storage.OptOutStrip:
+		event.Sess = ""
+		if err := web.historyWriter.WriteEvent(event); err != nil {
+			web.logger.Error(err)
+		}
+	}
+	metrics.Events.Inc()
+	if web.state(req).bots.BadUserAgent(req.UserAgent()) {
+		metrics.BotRejections.WithLabelValues("event").Inc()
+	} else {
+		site.TrackEvent(name)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,41 @@
+package topd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEventServer(t *testing.T) {
+	web := newTestWeb(t)
+
+	for _, c := range []struct {
+		path   string
+		status int
+	}{
+		{"/event/?id=1&name=signup&p=https://example.com/join", http.StatusNoContent},
+		{"/event/?id=1&name=purchase&value=9.99", http.StatusNoContent},
+		{"/event/?id=100&name=signup", http.StatusNotFound},
+		{"/event/?id=1&name=bad%20name", http.StatusBadRequest},
+		{"/event/?id=1&name=purchase&value=NaN", http.StatusBadRequest},
+	} {
+		rec := httptest.NewRecorder()
+		web.EventServer(rec, httptest.NewRequest(http.MethodGet, c.path, nil))
+		if rec.Code != c.status {
+			t.Errorf("%s: expected %d, got %d", c.path, c.status, rec.Code)
+		}
+	}
+
+	site, _ := web.siteMap.Get(1)
+	stat := site.Stat()
+	if stat.Events["signup"] != 1 || stat.Events["purchase"] != 1 {
+		t.Errorf("unexpected events %v", stat.Events)
+	}
+	// test web defines "signup" goal for the first site
+	if stat.Goals["signup"] != 1 {
+		t.Errorf("unexpected goals %v", stat.Goals)
+	}
+	if events := web.historyWriter.(*historyRecorder).events; len(events) != 2 || *events[1].Value != 9.99 {
+		t.Errorf("unexpected stored events %+v", events)
+	}
+}
@@ -0,0 +1,51 @@
+package topd
+
+import (
+	"net/http"
+)
+
+// HealthCheck is a named readiness probe
+type HealthCheck struct {
+	Name  string
+	Check func() error
+}
+
+type checkResult struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type readiness struct {
+	Status string        `json:"status"`
+	Checks []checkResult `json:"checks,omitempty"`
+}
+
+// HealthServer reports the process is alive
+func (web *Web) HealthServer(w http.ResponseWriter, _ *http.Request) {
+	if err := writeJSON(w, http.StatusOK, readiness{Status: "ok"}); err != nil {
+		web.logger.Error(err)
+	}
+}
+
+// ReadyServer runs every readiness check and fails when any of them fails
+func (web *Web) ReadyServer(w http.ResponseWriter, _ *http.Request) {
+
+	status := http.StatusOK
+	result := readiness{Status: "ok", Checks: make([]checkResult, 0, len(web.checks))}
+
+	for _, c := range web.checks {
+		res := checkResult{Name: c.Name, OK: true}
+		if err := c.Check(); err != nil {
+			res.OK = false
+			res.Reason = err.Error()
+			result.Status = "fail"
+			status = http.StatusServiceUnavailable
+		}
+		result.Checks = append(result.Checks, res)
+	}
+
+	if err := writeJSON(w, status, result); err != nil {
+		web.logger.Error(err)
+	}
+}
@@ -0,0 +1,57 @@
+package topd
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/felicson/topd/storage"
+)
+
+func TestReadyServer(t *testing.T) {
+	web := newTestWeb(t)
+	stopped := storage.NewHistoryCollector(&storage.HistoryBuffer{}, 1)
+	ok := func() error { return nil }
+
+	for _, c := range []struct {
+		name   string
+		check  HealthCheck
+		reason string
+	}{
+		{"ping error", HealthCheck{Name: "storage", Check: func() error { return errors.New("connection refused") }}, "connection refused"},
+		{"inactive collector", HealthCheck{Name: "history_collector", Check: stopped.Ready}, storage.ErrHistoryCollectorStopped.Error()},
+		{"saturated buffer", HealthCheck{Name: "history_collector", Check: func() error { return storage.ErrHistoryCollectorSaturated }}, storage.ErrHistoryCollectorSaturated.Error()},
+		{"failed flush", HealthCheck{Name: "keeper", Check: func() error { return errors.New("flush at 2026-01-10T00:00:00Z failed: storage is down") }}, "flush at 2026-01-10T00:00:00Z failed: storage is down"},
+		{"ok", HealthCheck{Name: "storage", Check: ok}, ""},
+	} {
+		web.checks = []HealthCheck{{Name: "other", Check: ok}, c.check}
+
+		rec := httptest.NewRecorder()
+		web.ReadyServer(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var result readiness
+		if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if len(result.Checks) != 2 || !result.Checks[0].OK || result.Checks[1].Name != c.check.Name {
+			t.Errorf("%s: unexpected checks %+v", c.name, result.Checks)
+			continue
+		}
+		if c.reason == "" {
+			if rec.Code != http.StatusOK || result.Status != "ok" || !result.Checks[1].OK {
+				t.Errorf("%s: unexpected response %d %+v", c.name, rec.Code, result)
+			}
+			continue
+		}
+		if rec.Code != http.StatusServiceUnavailable || result.Status != "fail" || result.Checks[1].OK || result.Checks[1].Reason != c.reason {
+			t.Errorf("%s: unexpected response %d %+v", c.name, rec.Code, result)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	web.HealthServer(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("healthz: unexpected status %d", rec.Code)
+	}
+}
@@ -0,0 +1,62 @@
+package topd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/felicson/topd/image"
+	"github.com/felicson/topd/internal/activity"
+	"github.com/felicson/topd/internal/bot"
+	"github.com/felicson/topd/internal/config"
+	"github.com/felicson/topd/internal/session"
+	"github.com/felicson/topd/storage"
+	"github.com/felicson/topd/storage/memory"
+	"go.uber.org/zap"
+)
+
+func newTestWeb(t *testing.T) *Web {
+	images, err := image.NewImages("counters/m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, _ := memory.New(config.Config{})
+	if err := store.SetGoal(storage.Goal{ID: 1, SiteID: 1, Name: "signup", Event: "signup"}); err != nil {
+		t.Fatal(err)
+	}
+	siteMap := storage.NewSiteAggregate(store)
+	if err := siteMap.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	bots, err := bot.NewCheckerFromFile("bots.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Web{
+		siteMap:        &siteMap,
+		sessionPerSite: storage.NewSessionPerSite(),
+		config:         newLiveConfig(liveState{bots: &bots, images: images}),
+		historyWriter:  &historyRecorder{},
+		logger:         zap.NewNop().Sugar(),
+		visitors:       session.NewDailyHasher(time.UTC),
+		recent:         activity.NewRecent(10),
+		live:           activity.NewHub(10, nil),
+		renders:        image.NewCache(10, nil),
+	}
+}
+
+type historyRecorder struct {
+	rows   []storage.RawTopData
+	events []storage.Event
+}
+
+func (hr *historyRecorder) WriteHistory(data storage.RawTopData) error {
+	hr.rows = append(hr.rows, data)
+	return nil
+}
+
+func (hr *historyRecorder) WriteEvent(event storage.Event) error {
+	hr.events = append(hr.events, event)
+	return nil
+}
@@ -0,0 +1,104 @@
+package image
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"sync"
+)
+
+// Cache keeps encoded counters by image, format and values, the least recently used are evicted
+// when number of entries exceeds size. Counters without digits are never cached as they are precomputed.
+type Cache struct {
+	lock    sync.Mutex
+	size    int
+	entries map[cacheKey]*list.Element
+	order   *list.List // front is the most recently used
+	missed  func()
+}
+
+type cacheKey struct {
+	counter *prerendered // unique per loaded image, so reloaded counters do not hit stale entries
+	format  Format
+	hits    int
+	hosts   int
+}
+
+type cacheEntry struct {
+	key  cacheKey
+	data []byte
+}
+
+// NewCache creates cache of size encoded counters, missed is called on each render
+func NewCache(size int, missed func()) *Cache {
+	if missed == nil {
+		missed = func() {}
+	}
+	return &Cache{
+		size:    size,
+		entries: make(map[cacheKey]*list.Element),
+		order:   list.New(),
+		missed:  missed,
+	}
+}
+
+// Render writes cached counter, rendering and caching it on miss
+func (c *Cache) Render(w io.Writer, img Image, format Format, hits, hosts int) error {
+
+	if img.pre == nil || !digits(hits, hosts) {
+		return img.Render(w, format, hits, hosts)
+	}
+	key := cacheKey{counter: img.pre, format: img.Output(format), hits: hits, hosts: hosts}
+	if data, ok := c.get(key); ok {
+		_, err := w.Write(data)
+		return err
+	}
+
+	c.missed()
+	var buf bytes.Buffer
+	if err := img.Render(&buf, format, hits, hosts); err != nil {
+		return err
+	}
+	c.add(key, buf.Bytes())
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Len returns number of cached counters
+func (c *Cache) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.order.Len()
+}
+
+func (c *Cache) get(key cacheKey) ([]byte, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*cacheEntry).data, true
+}
+
+func (c *Cache) add(key cacheKey, data []byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// concurrent miss of the same counter has added it already
+	if el, ok := c.entries[key]; ok {
+		c.order.MoveToFront(el)
+		return
+	}
+	if c.order.Len() >= c.size {
+		oldest := c.order.Back()
+		if oldest == nil {
+			return
+		}
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, data: data})
+}
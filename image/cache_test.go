@@ -0,0 +1,62 @@
+package image
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCache(t *testing.T) {
+	img, err := NewImage("../counters/m/counter1.gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewImage("../counters/m/counter1.gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	misses := 0
+	cache := NewCache(2, func() { misses++ })
+	render := func(img Image, format Format, hits, hosts int) []byte {
+		var buf bytes.Buffer
+		if err := cache.Render(&buf, img, format, hits, hosts); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	first := render(img, FormatPNG, 10, 5)
+	if cached := render(img, FormatPNG, 10, 5); !bytes.Equal(first, cached) || misses != 1 {
+		t.Fatalf("expected cached counter, misses %d", misses)
+	}
+	var direct bytes.Buffer
+	if err := img.Draw(&direct, 10, 5); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first, direct.Bytes()) {
+		t.Error("cached counter differs from drawn one")
+	}
+
+	// counters without digits are precomputed
+	render(img, FormatPNG, 0, 5)
+	render(img, FormatSVG, 0, 0)
+	if misses != 1 || cache.Len() != 1 {
+		t.Errorf("static counters are cached: misses %d, len %d", misses, cache.Len())
+	}
+
+	// reloaded image has own entries
+	render(other, FormatPNG, 10, 5)
+	render(img, FormatSVG, 10, 5)
+	if misses != 3 || cache.Len() != 2 {
+		t.Errorf("unexpected misses %d, len %d", misses, cache.Len())
+	}
+	// the least recently used is evicted
+	render(img, FormatPNG, 10, 5)
+	if misses != 4 {
+		t.Errorf("evicted counter is not rendered, misses %d", misses)
+	}
+
+	if err := cache.Render(&direct, Image{}, FormatPNG, 1, 1); err == nil {
+		t.Error("expected error for not loaded image")
+	}
+}
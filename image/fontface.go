@@ -0,0 +1,46 @@
+package image
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+)
+
+// fontFace makes faces of counter font, a face is not safe for concurrent use
+// so one is made per drawing. Both *bdf.Font and vectorFont implement it.
+type fontFace interface {
+	NewFace() font.Face
+}
+
+// vectorFont is truetype or opentype font scaled by template size and dpi, glyphs are anti-aliased
+type vectorFont struct {
+	font *opentype.Font
+	opts opentype.FaceOptions
+}
+
+// NewFace returns face of the font at template size
+func (v vectorFont) NewFace() font.Face {
+	// opentype.NewFace does not fail on parsed font
+	face, _ := opentype.NewFace(v.font, &v.opts)
+	return face
+}
+
+// svgFont returns font-family and font-size in pixels used for svg text
+func svgFont(f fontFace) (string, int) {
+
+	v, ok := f.(vectorFont)
+	if !ok {
+		m := f.NewFace().Metrics()
+		return "monospace", (m.Ascent + m.Descent).Ceil()
+	}
+	size := int(math.Round(v.opts.Size * v.opts.DPI / 72))
+	family, err := v.font.Name(nil, sfnt.NameIDFamily)
+	if err != nil || family == "" || strings.ContainsAny(family, `"'<>&`) {
+		return "monospace", size
+	}
+	return fmt.Sprintf("'%s', monospace", family), size
+}
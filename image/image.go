@@ -3,25 +3,24 @@ package image
 //go:generate go-bindata -pkg $GOPACKAGE -o font2.go 5x8.bdf
 
 import (
+	"bytes"
+	"encoding/base64"
 	"errors"
+	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
-	"image/gif"
+	_ "image/gif" // registers gif decoder
 	"image/png"
 	"io"
+	"io/ioutil"
 	"os"
-	"path"
+	"path/filepath"
 	"strconv"
 	"sync"
-
-	"github.com/zachomedia/go-bdf"
-	"golang.org/x/image/font"
-	"golang.org/x/image/math/fixed"
 )
 
 var (
-	delim       = [15]byte{' ', ' ', ' ', ' ', ' ', ' ', ' ', ' ', ' ', ' ', ' ', ' ', ' ', ' ', ' '}
 	encoderPool = sync.Pool{
 		New: func() interface{} {
 			return &pngPool{}
@@ -43,8 +42,21 @@ func (p *pngPool) Put(e *png.EncoderBuffer) {
 
 //Image struct for render counter image
 type Image struct {
-	image image.Image //decoded image
-	font  *bdf.Font
+	image    image.Image //decoded image
+	family   string      // font-family for svg
+	template Template
+	fontSize int    // text height in pixels for svg
+	data     string // source image data uri used as svg background
+	raster   Format // png, png8 or gif output of template
+	pre      *prerendered
+}
+
+// prerendered is computed once per loaded counter
+type prerendered struct {
+	background *image.RGBA       // source image copied into each drawn counter
+	glyphs     *glyphs           // digit sprites of template font
+	palette    color.Palette     // colors of gif and png8 output
+	static     map[Format][]byte // encoded counters without digits
 }
 
 type ImageList map[uint]Image
@@ -52,50 +64,78 @@ type ImageList map[uint]Image
 //NewImage constructor
 func NewImage(path string) (Image, error) {
 
-	img, err := os.Open(path)
+	raw, err := ioutil.ReadFile(path)
 	if err != nil {
 		return Image{}, err
 	}
-	defer img.Close()
 
-	imgDecoded, err := gif.Decode(img)
+	imgDecoded, format, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return Image{}, fmt.Errorf("on decode %s: %v", path, err)
+	}
+	tpl, dir, err := loadTemplate(path)
 	if err != nil {
 		return Image{}, err
 	}
-	f, err := bdf.Parse(__5x8Bdf)
+	if err := tpl.prepare(); err != nil {
+		return Image{}, fmt.Errorf("on prepare template of %s: %v", path, err)
+	}
+	f, err := tpl.loadFont(dir)
 	if err != nil {
 		return Image{}, err
 	}
-	return Image{image: imgDecoded, font: f}, nil
+	family, size := svgFont(f)
+	img := Image{
+		image:    imgDecoded,
+		template: tpl,
+		raster:   tpl.raster(),
+		family:   family,
+		fontSize: size,
+		data:     "data:image/" + format + ";base64," + base64.StdEncoding.EncodeToString(raw),
+	}
+	if err := img.prerender(f); err != nil {
+		return Image{}, fmt.Errorf("on prerender %s: %v", path, err)
+	}
+	return img, nil
 }
 
-func (i Image) Draw(w io.Writer, hits, hosts int) error {
-
-	const lenDelim = 15
-	var (
-		b  [64]byte
-		bs = b[:0]
-	)
-	hostsWidth := numWidth(hosts)
-	hitsWidth := numWidth(hits)
+// prerender makes digit sprites and encodes counter without digits in every format
+func (i *Image) prerender(f fontFace) error {
 
-	if hits > 0 && hosts > 0 {
-		bs = strconv.AppendInt(bs, int64(hosts), 10)
-		bs = append(bs, delim[:lenDelim-hostsWidth-hitsWidth]...)
-		bs = strconv.AppendInt(bs, int64(hits), 10)
+	g, err := newGlyphs(f.NewFace())
+	if err != nil {
+		return err
+	}
+	background := image.NewRGBA(i.image.Bounds())
+	draw.Draw(background, background.Bounds(), i.image, i.image.Bounds().Min, draw.Src)
+	i.pre = &prerendered{
+		background: background,
+		glyphs:     g,
+		palette:    counterPalette(i.image, i.template.Texts),
+		static:     make(map[Format][]byte),
 	}
 
-	col := color.RGBA{0, 0, 0, 255}
-	point := fixed.P(6, 26)
-	newImage := image.NewRGBA(i.image.Bounds())
-	draw.Draw(newImage, i.image.Bounds(), i.image, image.Point{}, draw.Src)
-	d := font.Drawer{
-		Dst:  newImage,
-		Src:  image.NewUniform(col),
-		Face: i.font.NewFace(),
-		Dot:  point,
+	formats := []Format{FormatPNG, FormatSVG}
+	if i.raster != FormatPNG {
+		formats = append(formats, i.raster)
+	}
+	for _, format := range formats {
+		var buf bytes.Buffer
+		if err := i.render(&buf, format, 0, 0); err != nil {
+			return err
+		}
+		i.pre.static[format] = buf.Bytes()
 	}
-	d.DrawBytes(bs)
+	return nil
+}
+
+// digits reports whether values are drawn, they are shown only when both are known
+func digits(hits, hosts int) bool {
+	return hits > 0 && hosts > 0
+}
+
+// Draw writes counter as png
+func (i Image) Draw(w io.Writer, hits, hosts int) error {
 
 	bPool := encoderPool.Get().(*pngPool)
 	defer encoderPool.Put(bPool)
@@ -104,49 +144,55 @@ func (i Image) Draw(w io.Writer, hits, hosts int) error {
 		CompressionLevel: png.NoCompression,
 		BufferPool:       bPool,
 	}
-	if err := enc.Encode(w, newImage); err != nil {
+	if err := enc.Encode(w, i.draw(hits, hosts)); err != nil {
 		return err
 	}
 	return nil
 }
 
-func numWidth(i int) int {
-	var cnt int
-	for i > 0 {
-		i = i / 10
-		cnt++
-	}
-	return cnt
-}
-
-func NewImages(imagePath string) (ImageList, error) {
-
-	imageList := make(map[uint]Image, 4)
+// draw returns background with digits
+func (i Image) draw(hits, hosts int) *image.RGBA {
 
-	countersDir, err := os.Open(imagePath)
+	var b [20]byte
 
-	if err != nil {
-		return nil, err
+	bg := i.pre.background
+	newImage := &image.RGBA{
+		Pix:    append([]byte(nil), bg.Pix...),
+		Stride: bg.Stride,
+		Rect:   bg.Rect,
 	}
 
-	defer countersDir.Close()
+	if digits(hits, hosts) {
+		for _, text := range i.template.Texts {
+			bs := strconv.AppendInt(b[:0], int64(text.value(hits, hosts)), 10)
+			i.pre.glyphs.draw(newImage, text.src, text.origin(i.pre.glyphs.measure(bs)), text.Y, bs)
+		}
+	}
+	return newImage
+}
 
-	fileList, err := countersDir.Readdir(-1)
+// NewImages loads counters listed in manifest.yml of the directory,
+// without manifest every counter<id>.gif and counter<id>.png file is loaded
+func NewImages(imagePath string) (ImageList, error) {
 
+	entries, err := readManifest(imagePath)
+	if os.IsNotExist(err) {
+		entries, err = scanCounters(imagePath)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	for _, f := range fileList {
-
-		if ext := path.Ext(f.Name()); ext == ".gif" {
-			id, _ := strconv.Atoi(f.Name()[7:8])
-			img, err := NewImage(path.Join(imagePath, f.Name()))
-			if err != nil {
-				return nil, err
-			}
-			imageList[uint(id)] = img
+	imageList := make(ImageList, len(entries))
+	for _, e := range entries {
+		if _, ok := imageList[e.ID]; ok {
+			return nil, fmt.Errorf("duplicate counter id %d: %s", e.ID, e.File)
 		}
+		img, err := NewImage(filepath.Join(imagePath, e.File))
+		if err != nil {
+			return nil, fmt.Errorf("on load counter %d: %v", e.ID, err)
+		}
+		imageList[e.ID] = img
 	}
 	return imageList, nil
 }
@@ -158,3 +204,17 @@ func (images ImageList) GetImage(ID uint) (Image, error) {
 	}
 	return Image{}, errors.New("image not found")
 }
+
+// Lowest returns the lowest loaded counter id, false when the list is empty
+func (images ImageList) Lowest() (uint, bool) {
+	var (
+		lowest uint
+		found  bool
+	)
+	for id := range images {
+		if !found || id < lowest {
+			lowest, found = id, true
+		}
+	}
+	return lowest, found
+}
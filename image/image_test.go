@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"os"
 	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -39,3 +40,72 @@ func BenchmarkDraw(b *testing.B) {
 		}
 	}
 }
+
+func BenchmarkDrawStatic(b *testing.B) {
+	image, err := NewImage("../counters/m/counter1.gif")
+	if err != nil {
+		b.Fatal(err)
+	}
+	var buf bytes.Buffer
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		if err = image.Render(&buf, FormatPNG, 0, 0); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDrawCached(b *testing.B) {
+	image, err := NewImage("../counters/m/counter1.gif")
+	if err != nil {
+		b.Fatal(err)
+	}
+	cache := NewCache(1024, nil)
+	var buf bytes.Buffer
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		// most requests repeat values of a few busy sites
+		if err = cache.Render(&buf, image, FormatPNG, 10+i%512, 212); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestDrawSVG(t *testing.T) {
+	image, err := NewImage("../counters/m/counter1.gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := image.Render(&buf, FormatSVG, 212, 10); err != nil {
+		t.Fatal(err)
+	}
+	svg := buf.String()
+	for _, part := range []string{`<svg `, `data:image/gif;base64,R0lGOD`, `class="hosts" x="6" y="26" text-anchor="start" fill="#000000">10<`, `class="hits" x="81" y="26" text-anchor="end" fill="#000000">212<`, `</svg>`} {
+		if !strings.Contains(svg, part) {
+			t.Errorf("%q is missing in %s", part, svg)
+		}
+	}
+}
+
+func TestAcceptsSVG(t *testing.T) {
+	for accept, svg := range map[string]bool{
+		"image/svg+xml":                        true,
+		"image/svg+xml, image/*":               true,
+		"image/png;q=0.9, image/svg+xml;q=1.0": true,
+		"image/avif,image/webp,image/apng,image/svg+xml,image/*,*/*;q=0.8": false,
+		"image/png, image/svg+xml": false,
+		"image/svg+xml;q=0":        false,
+		"":                         false,
+	} {
+		if got := AcceptsSVG(accept); got != svg {
+			t.Errorf("%q: expected %v, got %v", accept, svg, got)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package image
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"gopkg.in/yaml.v2"
+)
+
+// manifestFile lists counters of the images directory with their ids
+const manifestFile = "manifest.yml"
+
+// counterName matches counter files named by id
+var counterName = regexp.MustCompile(`^counter([1-9][0-9]*)\.(gif|png)$`)
+
+// counterEntry is a counter source file relative to the images directory
+type counterEntry struct {
+	ID   uint
+	File string
+}
+
+// readManifest parses manifest.yml, a list of {id: 120, file: designs/blue.png} entries
+func readManifest(dir string) ([]counterEntry, error) {
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		return nil, err
+	}
+	var entries []counterEntry
+	if err := yaml.UnmarshalStrict(data, &entries); err != nil {
+		return nil, fmt.Errorf("on parse %s: %v", manifestFile, err)
+	}
+	for n, e := range entries {
+		if e.ID == 0 || e.File == "" {
+			return nil, fmt.Errorf("%s: entry %d: id and file are required", manifestFile, n)
+		}
+	}
+	return entries, nil
+}
+
+// scanCounters finds counter<id>.gif and counter<id>.png files, other images are reported as malformed
+func scanCounters(dir string) ([]counterEntry, error) {
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []counterEntry
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		ext := filepath.Ext(f.Name())
+		if ext != ".gif" && ext != ".png" {
+			continue
+		}
+		m := counterName.FindStringSubmatch(f.Name())
+		if m == nil {
+			return nil, fmt.Errorf("malformed counter file name %s, counter<id>%s is expected", f.Name(), ext)
+		}
+		id, err := strconv.ParseUint(m[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("malformed counter id in %s: %v", f.Name(), err)
+		}
+		entries = append(entries, counterEntry{ID: uint(id), File: f.Name()})
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no counters in %s", dir)
+	}
+	return entries, nil
+}
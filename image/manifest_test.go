@@ -0,0 +1,134 @@
+package image
+
+import (
+	"bytes"
+	"image/gif"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writePNGCounter(t *testing.T, dir, name string) {
+	f, err := os.Open("../counters/m/counter1.gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := gif.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewImagesNames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "counters")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	copyCounter(t, dir, "counter7.gif")
+	writePNGCounter(t, dir, "counter1024.png")
+	if err := ioutil.WriteFile(filepath.Join(dir, "README"), []byte("counters"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	images, err := NewImages(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 2 {
+		t.Fatalf("expected 2 counters, got %d", len(images))
+	}
+	img, err := images.GetImage(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := img.DrawSVG(&buf, 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "data:image/png;base64,") {
+		t.Errorf("png source is not embedded: %s", buf.String())
+	}
+}
+
+func TestNewImagesErrors(t *testing.T) {
+	for name, files := range map[string][]string{
+		"duplicate":  {"counter5.gif", "counter5.png"},
+		"leading 0":  {"counter05.gif"},
+		"no id":      {"counter.gif"},
+		"wrong name": {"blue.png"},
+		"zero id":    {"counter0.gif"},
+		"empty":      {},
+	} {
+		dir, err := ioutil.TempDir("", "counters")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range files {
+			copyCounter(t, dir, f)
+		}
+		if _, err := NewImages(dir); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "counters")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	copyCounter(t, dir, "blue.gif")
+	writePNGCounter(t, dir, "red.png")
+	// not listed in manifest, so its name is not checked
+	copyCounter(t, dir, "draft.gif")
+
+	manifest := "- {id: 10, file: blue.gif}\n- {id: 20, file: red.png}\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, manifestFile), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	images, err := NewImages(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 2 {
+		t.Fatalf("expected 2 counters, got %d", len(images))
+	}
+	for _, id := range []uint{10, 20} {
+		if _, err := images.GetImage(id); err != nil {
+			t.Errorf("counter %d: %v", id, err)
+		}
+	}
+
+	for _, manifest := range []string{
+		"- {id: 10, file: blue.gif}\n- {id: 10, file: red.png}\n",
+		"- {id: 0, file: blue.gif}\n",
+		"- {id: 10}\n",
+		"- {id: 10, file: blue.gif, size: 2}\n",
+		"- {id: 10, file: missing.gif}\n",
+		"- {id: 10, file: README}\n",
+		"id: 10\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, manifestFile), []byte(manifest), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewImages(dir); err == nil {
+			t.Errorf("%q: expected error", manifest)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package image
+
+import (
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"io"
+)
+
+// DrawGIF writes counter as gif with palette of the source image
+func (i Image) DrawGIF(w io.Writer, hits, hosts int) error {
+	return gif.Encode(w, i.paletted(hits, hosts), nil)
+}
+
+// DrawPNG8 writes counter as compressed paletted png
+func (i Image) DrawPNG8(w io.Writer, hits, hosts int) error {
+
+	bPool := encoderPool.Get().(*pngPool)
+	defer encoderPool.Put(bPool)
+
+	enc := &png.Encoder{
+		CompressionLevel: png.BestCompression,
+		BufferPool:       bPool,
+	}
+	return enc.Encode(w, i.paletted(hits, hosts))
+}
+
+// paletted maps drawn counter to the nearest colors of the palette, anti-aliased edges included
+func (i Image) paletted(hits, hosts int) *image.Paletted {
+	drawn := i.draw(hits, hosts)
+	p := image.NewPaletted(drawn.Rect, i.pre.palette)
+	draw.Draw(p, p.Rect, drawn, drawn.Rect.Min, draw.Src)
+	return p
+}
+
+// counterPalette returns palette of paletted source or web safe colors for true color one,
+// opaque text colors are added while there is room
+func counterPalette(src image.Image, texts []Text) color.Palette {
+
+	var p color.Palette
+	if paletted, ok := src.(*image.Paletted); ok {
+		p = append(p, paletted.Palette...)
+	} else {
+		p = append(p, palette.WebSafe...)
+	}
+	for _, text := range texts {
+		c := text.src.C
+		if _, _, _, a := c.RGBA(); a != 0xffff || len(p) >= 256 {
+			continue
+		}
+		if !sameColor(p[p.Index(c)], c) {
+			p = append(p, c)
+		}
+	}
+	return p
+}
+
+func sameColor(a, b color.Color) bool {
+	r1, g1, b1, a1 := a.RGBA()
+	r2, g2, b2, a2 := b.RGBA()
+	return r1 == r2 && g1 == g2 && b1 == b2 && a1 == a2
+}
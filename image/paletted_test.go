@@ -0,0 +1,118 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPaletted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "counters")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for id, output := range map[string]string{"1": "gif", "2": "png8", "3": "png"} {
+		copyCounter(t, dir, "counter"+id+".gif")
+		tpl := "output: " + output + "\ntexts: [{metric: hits, x: 81, y: 26, align: right, color: '#fe0102'}]"
+		if err := ioutil.WriteFile(filepath.Join(dir, "counter"+id+".yml"), []byte(tpl), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	images, err := NewImages(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := os.Open(filepath.Join(dir, "counter1.gif"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+	sourceGIF, err := gif.Decode(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	colors := len(sourceGIF.(*image.Paletted).Palette)
+
+	render := func(id uint, format Format) ([]byte, Format) {
+		img, err := images.GetImage(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := img.Render(&buf, format, 1234, 56); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes(), img.Output(format)
+	}
+
+	full, format := render(3, FormatDefault)
+	if format != FormatPNG {
+		t.Errorf("png counter is written as %v", format)
+	}
+
+	data, format := render(1, FormatDefault)
+	if format != FormatGIF || format.ContentType() != "image/gif" {
+		t.Errorf("gif counter is written as %v", format)
+	}
+	decoded, err := gif.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// text color follows source colors, encoder pads palette to power of two
+	if p := decoded.(*image.Paletted).Palette; len(p) <= colors || !sameColor(p[colors], color.RGBA{R: 0xfe, G: 1, B: 2, A: 0xff}) {
+		t.Errorf("text color is not added to %d source colors: %v", colors, p)
+	}
+	if len(data)*4 > len(full) {
+		t.Errorf("gif is %d bytes, png %d bytes", len(data), len(full))
+	}
+
+	data, format = render(2, FormatDefault)
+	if format != FormatPNG8 || format.ContentType() != "image/png" {
+		t.Errorf("png8 counter is written as %v", format)
+	}
+	decoded, err = png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := decoded.(*image.Paletted); !ok || len(data)*4 > len(full) {
+		t.Errorf("png8 is %T of %d bytes, png %d bytes", decoded, len(data), len(full))
+	}
+
+	if _, format := render(1, FormatSVG); format != FormatSVG {
+		t.Errorf("svg is not kept for gif counter")
+	}
+	data, format = render(1, FormatPNG)
+	if format != FormatPNG {
+		t.Errorf("explicit png is written as %v", format)
+	}
+	if decoded, err = png.Decode(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := decoded.(*image.Paletted); ok {
+		t.Error("explicit png of gif counter is paletted")
+	}
+}
+
+func TestPalettedOutputError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "counters")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	copyCounter(t, dir, "counter1.gif")
+	if err := ioutil.WriteFile(filepath.Join(dir, "counter1.yml"), []byte("output: jpeg"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewImages(dir); err == nil {
+		t.Error("expected error for unknown output")
+	}
+}
@@ -0,0 +1,73 @@
+package image
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// sprite is glyph mask rendered at the origin, bounds of the mask are relative to the dot
+type sprite struct {
+	mask    *image.Alpha
+	advance fixed.Int26_6
+}
+
+// glyphs are digit sprites of counter font, composited instead of rasterizing text per request.
+// Bitmap fonts and fully hinted vector fonts advance by whole pixels, so the result equals font.Drawer output.
+type glyphs struct {
+	digits [10]sprite
+	kern   [10][10]fixed.Int26_6
+}
+
+func newGlyphs(face font.Face) (*glyphs, error) {
+
+	g := &glyphs{}
+	for n := range g.digits {
+		r := rune('0' + n)
+		dr, mask, maskp, advance, ok := face.Glyph(fixed.Point26_6{}, r)
+		if !ok {
+			return nil, fmt.Errorf("font has no glyph %q", r)
+		}
+		// face reuses mask buffer between calls
+		alpha := image.NewAlpha(dr)
+		draw.Draw(alpha, dr, mask, maskp, draw.Src)
+		g.digits[n] = sprite{mask: alpha, advance: advance}
+
+		for m := range g.kern[n] {
+			g.kern[n][m] = face.Kern(r, rune('0'+m))
+		}
+	}
+	return g, nil
+}
+
+// measure returns width of digits in pixels
+func (g *glyphs) measure(digits []byte) int {
+	var width fixed.Int26_6
+	for n, c := range digits {
+		if n > 0 {
+			width += g.kern[digits[n-1]-'0'][c-'0']
+		}
+		width += g.digits[c-'0'].advance
+	}
+	return width.Round()
+}
+
+// draw composites digits filled with src starting at baseline point x, y
+func (g *glyphs) draw(dst draw.Image, src image.Image, x, y int, digits []byte) {
+	dot := fixed.P(x, y)
+	for n, c := range digits {
+		if n > 0 {
+			dot.X += g.kern[digits[n-1]-'0'][c-'0']
+		}
+		s := g.digits[c-'0']
+		bounds := s.mask.Bounds()
+		if !bounds.Empty() {
+			at := image.Pt(dot.X.Round(), dot.Y.Round())
+			draw.DrawMask(dst, bounds.Add(at), src, image.Point{}, s.mask, bounds.Min, draw.Over)
+		}
+		dot.X += s.advance
+	}
+}
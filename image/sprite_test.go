@@ -0,0 +1,69 @@
+package image
+
+import (
+	"image"
+	"image/draw"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/math/fixed"
+)
+
+// drawText renders values with font.Drawer as counters did before sprites
+func drawText(img Image, f fontFace, hits, hosts int) *image.RGBA {
+	dst := image.NewRGBA(img.image.Bounds())
+	draw.Draw(dst, dst.Bounds(), img.image, image.Point{}, draw.Src)
+	d := font.Drawer{Dst: dst, Face: f.NewFace()}
+	for _, text := range img.template.Texts {
+		bs := []byte(strconv.Itoa(text.value(hits, hosts)))
+		d.Src = text.src
+		d.Dot = fixed.P(text.origin(d.MeasureBytes(bs).Round()), text.Y)
+		d.DrawBytes(bs)
+	}
+	return dst
+}
+
+func TestGlyphs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "counters")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	copyCounter(t, dir, "counter1.gif")
+	copyCounter(t, dir, "counter2.gif")
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.ttf"), goregular.TTF, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tpl := "{font: go.ttf, size: 10, texts: [{metric: hosts, x: 4, y: 24}, {metric: hits, x: 84, y: 24, align: right, color: '#ff000080'}]}"
+	if err := ioutil.WriteFile(filepath.Join(dir, "counter2.yml"), []byte(tpl), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"counter1.gif", "counter2.gif"} {
+		img, err := NewImage(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := img.template.loadFont(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range [][2]int{{1, 1}, {10, 7}, {1234567890, 98765}} {
+			expected := drawText(img, f, v[0], v[1])
+			drawn := &image.RGBA{Pix: append([]byte(nil), img.pre.background.Pix...), Stride: expected.Stride, Rect: expected.Rect}
+			for _, text := range img.template.Texts {
+				bs := []byte(strconv.Itoa(text.value(v[0], v[1])))
+				img.pre.glyphs.draw(drawn, text.src, text.origin(img.pre.glyphs.measure(bs)), text.Y, bs)
+			}
+			if string(drawn.Pix) != string(expected.Pix) {
+				t.Errorf("%s %v: sprites differ from font drawer", name, v)
+			}
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package image
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Format of rendered counter
+type Format uint8
+
+const (
+	// FormatPNG is the counter drawn over gif template
+	FormatPNG Format = iota
+	// FormatSVG is the counter text over embedded gif template, scales without blur
+	FormatSVG
+	// FormatPNG8 is compressed png with palette of the template
+	FormatPNG8
+	// FormatGIF is gif with palette of the template
+	FormatGIF
+	// FormatDefault is requested when client asks for no format, see Image.Output
+	FormatDefault
+)
+
+// ParseFormat returns format by name
+func ParseFormat(name string) (Format, bool) {
+	switch name {
+	case "png":
+		return FormatPNG, true
+	case "svg":
+		return FormatSVG, true
+	}
+	return FormatPNG, false
+}
+
+// ContentType returns media type of the format
+func (f Format) ContentType() string {
+	switch f {
+	case FormatSVG:
+		return "image/svg+xml"
+	case FormatGIF:
+		return "image/gif"
+	}
+	return "image/png"
+}
+
+// Output returns format the counter is written in for requested one,
+// default request is served in raster output of the counter template
+func (i Image) Output(format Format) Format {
+	if format == FormatDefault {
+		return i.raster
+	}
+	return format
+}
+
+// Render writes counter in the format, counters without digits are written precomputed
+func (i Image) Render(w io.Writer, format Format, hits, hosts int) error {
+	if i.pre == nil {
+		return errors.New("counter image is not loaded")
+	}
+	format = i.Output(format)
+	if data, ok := i.pre.static[format]; ok && !digits(hits, hosts) {
+		_, err := w.Write(data)
+		return err
+	}
+	return i.render(w, format, hits, hosts)
+}
+
+func (i Image) render(w io.Writer, format Format, hits, hosts int) error {
+	switch format {
+	case FormatSVG:
+		return i.DrawSVG(w, hits, hosts)
+	case FormatPNG8:
+		return i.DrawPNG8(w, hits, hosts)
+	case FormatGIF:
+		return i.DrawGIF(w, hits, hosts)
+	}
+	return i.Draw(w, hits, hosts)
+}
+
+// DrawSVG writes counter as svg, digits can be themed with .hosts and .hits css classes
+func (i Image) DrawSVG(w io.Writer, hits, hosts int) error {
+
+	bounds := i.image.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="%d" height="%d" viewBox="0 0 %d %d">`,
+		width, height, width, height)
+	fmt.Fprintf(bw, `<image width="%d" height="%d" style="image-rendering:pixelated" xlink:href="%s"/>`,
+		width, height, i.data)
+
+	if digits(hits, hosts) {
+		fmt.Fprintf(bw, `<g font-family="%s" font-size="%d">`, i.family, i.fontSize)
+		for _, text := range i.template.Texts {
+			fmt.Fprintf(bw, `<text class="%s" x="%d" y="%d" text-anchor="%s" fill="%s">%d</text>`,
+				text.Metric, text.X, text.Y, text.anchor(), text.fill(), text.value(hits, hosts))
+		}
+		bw.WriteString(`</g>`)
+	}
+	bw.WriteString(`</svg>`)
+	return bw.Flush()
+}
+
+// AcceptsSVG reports whether svg is the most preferred media type of Accept header
+func AcceptsSVG(accept string) bool {
+
+	best, bestQ := "", -1.0
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		media := strings.ToLower(strings.TrimSpace(params[0]))
+		q := 1.0
+		for _, p := range params[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				if _, err := fmt.Sscanf(p[2:], "%g", &q); err != nil {
+					q = 0
+				}
+			}
+		}
+		if media != "" && q > bestQ {
+			best, bestQ = media, q
+		}
+	}
+	return best == "image/svg+xml" && bestQ > 0
+}
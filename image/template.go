@@ -0,0 +1,221 @@
+package image
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/zachomedia/go-bdf"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"gopkg.in/yaml.v2"
+)
+
+// builtinFont is the bdf font compiled into binary
+const builtinFont = "5x8"
+
+// default size in points and resolution of truetype and opentype fonts
+const (
+	defaultFontSize = 12
+	defaultFontDPI  = 72
+)
+
+// templateExts are extensions of template file next to counter gif, json is parsed as yaml
+var templateExts = []string{".yml", ".yaml", ".json"}
+
+// Template describes what is drawn over counter background
+type Template struct {
+	Font   string  // builtin 5x8 or path to bdf, ttf or otf file relative to the template
+	Size   float64 // size in points of ttf and otf font
+	DPI    float64 // resolution of ttf and otf font
+	Output string  // png (true color, default), png8 or gif paletted with source colors
+	Texts  []Text
+}
+
+// Text is a metric value drawn at baseline point X, Y
+type Text struct {
+	Metric string // hits or hosts
+	X      int
+	Y      int
+	Align  string // left, right or center relative to X
+	Color  string // #rgb, #rrggbb or #rrggbbaa, black by default
+
+	src *image.Uniform
+}
+
+// defaultTemplate is layout of the original counters: hosts on the left, hits on the right
+var defaultTemplate = Template{
+	Font: builtinFont,
+	Texts: []Text{
+		{Metric: "hosts", X: 6, Y: 26},
+		{Metric: "hits", X: 81, Y: 26, Align: "right"},
+	},
+}
+
+// loadTemplate reads template of the gif counter, default one is used when there is no file
+func loadTemplate(gifPath string) (Template, string, error) {
+
+	base := strings.TrimSuffix(gifPath, filepath.Ext(gifPath))
+	for _, ext := range templateExts {
+		data, err := ioutil.ReadFile(base + ext)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return Template{}, "", err
+		}
+		var t Template
+		if err := yaml.UnmarshalStrict(data, &t); err != nil {
+			return Template{}, "", fmt.Errorf("on parse template %s: %v", base+ext, err)
+		}
+		return t, filepath.Dir(gifPath), nil
+	}
+	return defaultTemplate, "", nil
+}
+
+// prepare validates the template and parses its colors
+func (t *Template) prepare() error {
+
+	if t.Size < 0 || t.DPI < 0 {
+		return fmt.Errorf("negative font size or dpi")
+	}
+	if !t.isVector() && (t.Size != 0 || t.DPI != 0) {
+		return fmt.Errorf("size and dpi are set for bitmap font %q", t.Font)
+	}
+	switch t.Output {
+	case "", "png", "png8", "gif":
+	default:
+		return fmt.Errorf("unknown output %q", t.Output)
+	}
+
+	texts := make([]Text, len(t.Texts))
+	for n, text := range t.Texts {
+		switch text.Metric {
+		case "hits", "hosts":
+		default:
+			return fmt.Errorf("text %d: unknown metric %q", n, text.Metric)
+		}
+		switch text.Align {
+		case "", "left", "right", "center":
+		default:
+			return fmt.Errorf("text %d: unknown align %q", n, text.Align)
+		}
+		c, err := parseColor(text.Color)
+		if err != nil {
+			return fmt.Errorf("text %d: %v", n, err)
+		}
+		text.src = image.NewUniform(c)
+		texts[n] = text
+	}
+	t.Texts = texts
+	return nil
+}
+
+// raster returns format counter is drawn in unless svg is requested
+func (t Template) raster() Format {
+	switch t.Output {
+	case "png8":
+		return FormatPNG8
+	case "gif":
+		return FormatGIF
+	}
+	return FormatPNG
+}
+
+// isVector reports whether template font is truetype or opentype one
+func (t Template) isVector() bool {
+	switch strings.ToLower(filepath.Ext(t.Font)) {
+	case ".ttf", ".otf":
+		return true
+	}
+	return false
+}
+
+// loadFont returns builtin font or parses bdf, ttf or otf file from dir
+func (t Template) loadFont(dir string) (fontFace, error) {
+	if t.Font == "" || t.Font == builtinFont {
+		return bdf.Parse(__5x8Bdf)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, t.Font))
+	if err != nil {
+		return nil, fmt.Errorf("on read font: %v", err)
+	}
+	if !t.isVector() {
+		return bdf.Parse(data)
+	}
+	f, err := opentype.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("on parse font %s: %v", t.Font, err)
+	}
+	v := vectorFont{font: f, opts: opentype.FaceOptions{Size: t.Size, DPI: t.DPI, Hinting: font.HintingFull}}
+	if v.opts.Size == 0 {
+		v.opts.Size = defaultFontSize
+	}
+	if v.opts.DPI == 0 {
+		v.opts.DPI = defaultFontDPI
+	}
+	return v, nil
+}
+
+func (text Text) value(hits, hosts int) int {
+	if text.Metric == "hits" {
+		return hits
+	}
+	return hosts
+}
+
+// origin returns x of the text start for measured width
+func (text Text) origin(width int) int {
+	switch text.Align {
+	case "right":
+		return text.X - width
+	case "center":
+		return text.X - width/2
+	}
+	return text.X
+}
+
+// anchor returns svg text-anchor of the alignment
+func (text Text) anchor() string {
+	switch text.Align {
+	case "right":
+		return "end"
+	case "center":
+		return "middle"
+	}
+	return "start"
+}
+
+// fill returns svg color of the text
+func (text Text) fill() string {
+	c := color.NRGBAModel.Convert(text.src.C).(color.NRGBA)
+	if c.A == 0xff {
+		return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	}
+	return fmt.Sprintf("rgba(%d,%d,%d,%.3g)", c.R, c.G, c.B, float64(c.A)/0xff)
+}
+
+func parseColor(s string) (color.Color, error) {
+
+	if s == "" {
+		return color.Black, nil
+	}
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 8 || !strings.HasPrefix(s, "#") {
+		return nil, fmt.Errorf("wrong color %q", s)
+	}
+	// hex notation is not alpha premultiplied
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
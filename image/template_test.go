@@ -0,0 +1,156 @@
+package image
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func copyCounter(t *testing.T, dir, name string) {
+	data, err := ioutil.ReadFile("../counters/m/counter1.gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "counters")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	copyCounter(t, dir, "counter1.gif")
+	tpl := `{"texts": [{"metric": "hits", "x": 44, "y": 12, "align": "center", "color": "#f00"}]}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "counter1.json"), []byte(tpl), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := NewImage(filepath.Join(dir, "counter1.gif"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := img.Draw(&buf, 888, 1); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	red := 0
+	for y := 4; y < 14; y++ {
+		for x := 34; x < 54; x++ {
+			if decoded.At(x, y) == (color.RGBA{R: 0xff, A: 0xff}) {
+				red++
+			}
+		}
+	}
+	if red == 0 {
+		t.Error("hits are not drawn at template position")
+	}
+
+	buf.Reset()
+	if err := img.DrawSVG(&buf, 888, 1); err != nil {
+		t.Fatal(err)
+	}
+	if svg := buf.String(); !strings.Contains(svg, `<text class="hits" x="44" y="12" text-anchor="middle" fill="#ff0000">888</text></g>`) {
+		t.Errorf("unexpected svg %s", svg)
+	}
+}
+
+func TestTemplateErrors(t *testing.T) {
+	for _, tpl := range []string{
+		"texts: [{metric: visits}]",
+		"texts: [{metric: hits, align: top}]",
+		"texts: [{metric: hits, color: red}]",
+		"texts: [{metric: hits, colour: '#fff'}]",
+		"font: missing.bdf",
+		"{font: 5x8, size: 10}",
+		"{font: counter1.gif, size: 10}",
+		"{font: go.ttf, size: -1}",
+	} {
+		dir, err := ioutil.TempDir("", "counters")
+		if err != nil {
+			t.Fatal(err)
+		}
+		copyCounter(t, dir, "counter1.gif")
+		if err := ioutil.WriteFile(filepath.Join(dir, "counter1.yml"), []byte(tpl), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewImages(dir); err == nil {
+			t.Errorf("%s: expected error", tpl)
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestTemplateVectorFont(t *testing.T) {
+	dir, err := ioutil.TempDir("", "counters")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	copyCounter(t, dir, "counter1.gif")
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.ttf"), goregular.TTF, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tpl := "{font: go.ttf, size: 9, dpi: 96, texts: [{metric: hits, x: 44, y: 24, align: center, color: '#fff'}]}"
+	if err := ioutil.WriteFile(filepath.Join(dir, "counter1.yml"), []byte(tpl), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := NewImage(filepath.Join(dir, "counter1.gif"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := img.Draw(&buf, 888, 1); err != nil {
+		t.Fatal(err)
+	}
+	drawn, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	background, err := NewImage("../counters/m/counter1.gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// anti-aliased edges blend white text with background
+	white, blended := 0, 0
+	for y := 10; y < 26; y++ {
+		for x := 28; x < 60; x++ {
+			c, bg := drawn.At(x, y), background.image.At(x, y)
+			r, g, b, _ := c.RGBA()
+			switch {
+			case r == 0xffff && g == 0xffff && b == 0xffff:
+				white++
+			case c != color.Color(color.RGBAModel.Convert(bg)):
+				blended++
+			}
+		}
+	}
+	if white == 0 || blended == 0 {
+		t.Errorf("text is not anti-aliased: %d white and %d blended pixels", white, blended)
+	}
+
+	buf.Reset()
+	if err := img.DrawSVG(&buf, 888, 1); err != nil {
+		t.Fatal(err)
+	}
+	if svg := buf.String(); !strings.Contains(svg, `<g font-family="'Go', monospace" font-size="12">`) {
+		t.Errorf("unexpected svg %s", svg)
+	}
+}
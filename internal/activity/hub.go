@@ -0,0 +1,108 @@
+package activity
+
+import (
+	"sync"
+)
+
+// Subscription receives hits of a single site
+type Subscription struct {
+	C      <-chan Hit
+	ch     chan Hit
+	siteID int
+}
+
+// Hub fans out hits to subscribers. Publish never blocks:
+// hits are dropped for subscribers which do not keep up.
+type Hub struct {
+	lock    sync.RWMutex
+	buffer  int
+	closed  bool
+	subs    map[int]map[*Subscription]struct{}
+	dropped func()
+}
+
+// NewHub creates hub with buffer hits per subscriber, dropped is called for every dropped hit
+func NewHub(buffer int, dropped func()) *Hub {
+	return &Hub{
+		buffer:  buffer,
+		subs:    make(map[int]map[*Subscription]struct{}),
+		dropped: dropped,
+	}
+}
+
+// Subscribe starts receiving hits of the site, channel is closed when hub is closed
+func (h *Hub) Subscribe(siteID int) *Subscription {
+	ch := make(chan Hit, h.buffer)
+	s := &Subscription{C: ch, ch: ch, siteID: siteID}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.closed {
+		close(ch)
+		return s
+	}
+	if _, ok := h.subs[siteID]; !ok {
+		h.subs[siteID] = make(map[*Subscription]struct{})
+	}
+	h.subs[siteID][s] = struct{}{}
+	return s
+}
+
+// Unsubscribe stops receiving hits
+func (h *Hub) Unsubscribe(s *Subscription) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if subs, ok := h.subs[s.siteID]; ok {
+		if _, ok := subs[s]; ok {
+			delete(subs, s)
+			close(s.ch)
+		}
+		if len(subs) == 0 {
+			delete(h.subs, s.siteID)
+		}
+	}
+}
+
+// Publish sends hit to every subscriber of the site
+func (h *Hub) Publish(siteID int, hit Hit) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	for s := range h.subs[siteID] {
+		select {
+		case s.ch <- hit:
+		default:
+			if h.dropped != nil {
+				h.dropped()
+			}
+		}
+	}
+}
+
+// Len returns number of subscribers
+func (h *Hub) Len() int {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	var n int
+	for _, subs := range h.subs {
+		n += len(subs)
+	}
+	return n
+}
+
+// Close disconnects all subscribers
+func (h *Hub) Close() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for _, subs := range h.subs {
+		for s := range subs {
+			close(s.ch)
+		}
+	}
+	h.subs = make(map[int]map[*Subscription]struct{})
+	h.closed = true
+}
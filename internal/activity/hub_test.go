@@ -0,0 +1,46 @@
+package activity
+
+import (
+	"testing"
+)
+
+func TestHub(t *testing.T) {
+	var dropped int
+	h := NewHub(1, func() { dropped++ })
+
+	s1 := h.Subscribe(1)
+	s2 := h.Subscribe(2)
+
+	h.Publish(1, Hit{Page: "a"})
+	h.Publish(1, Hit{Page: "b"}) // buffer is full
+	h.Publish(3, Hit{Page: "c"})
+
+	if hit := <-s1.C; hit.Page != "a" {
+		t.Errorf("unexpected hit %+v", hit)
+	}
+	if dropped != 1 {
+		t.Errorf("expected single dropped hit, got %d", dropped)
+	}
+	select {
+	case hit := <-s2.C:
+		t.Errorf("unexpected hit of other site %+v", hit)
+	default:
+	}
+
+	h.Unsubscribe(s1)
+	if _, ok := <-s1.C; ok {
+		t.Error("channel is open after unsubscribe")
+	}
+	h.Unsubscribe(s1)
+
+	h.Close()
+	if _, ok := <-s2.C; ok {
+		t.Error("channel is open after close")
+	}
+	if h.Len() != 0 {
+		t.Errorf("unexpected subscribers %d", h.Len())
+	}
+	if _, ok := <-h.Subscribe(1).C; ok {
+		t.Error("subscribed to closed hub")
+	}
+}
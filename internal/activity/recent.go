@@ -0,0 +1,69 @@
+// Package activity keeps the latest hits of every site in memory
+package activity
+
+import (
+	"sync"
+	"time"
+)
+
+// Hit is a short description of accepted hit
+type Hit struct {
+	Page     string
+	Referrer string
+	Country  string
+	Bot      bool
+	Date     time.Time
+}
+
+// Recent holds fixed number of the latest hits per site
+type Recent struct {
+	lock  sync.RWMutex
+	size  int
+	sites map[int]*ring
+}
+
+type ring struct {
+	hits []Hit
+	next int
+}
+
+// NewRecent creates storage keeping size hits per site
+func NewRecent(size int) *Recent {
+	return &Recent{size: size, sites: make(map[int]*ring)}
+}
+
+// Add puts hit replacing the oldest one
+func (r *Recent) Add(siteID int, hit Hit) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	rg, ok := r.sites[siteID]
+	if !ok {
+		rg = &ring{hits: make([]Hit, 0, r.size)}
+		r.sites[siteID] = rg
+	}
+	if len(rg.hits) < r.size {
+		rg.hits = append(rg.hits, hit)
+		return
+	}
+	rg.hits[rg.next] = hit
+	rg.next = (rg.next + 1) % r.size
+}
+
+// List returns hits of the site starting from the newest
+func (r *Recent) List(siteID int) []Hit {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	rg, ok := r.sites[siteID]
+	if !ok {
+		return nil
+	}
+	n := len(rg.hits)
+	result := make([]Hit, 0, n)
+	for i := 1; i <= n; i++ {
+		// next points to the oldest element when ring is full
+		result = append(result, rg.hits[(rg.next-i+n)%n])
+	}
+	return result
+}
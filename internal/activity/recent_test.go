@@ -0,0 +1,28 @@
+package activity
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestRecent(t *testing.T) {
+	r := NewRecent(3)
+	for i := 1; i <= 5; i++ {
+		r.Add(1, Hit{Page: strconv.Itoa(i)})
+	}
+	r.Add(2, Hit{Page: "a"})
+
+	var pages string
+	for _, h := range r.List(1) {
+		pages += h.Page
+	}
+	if pages != "543" {
+		t.Errorf("expected 543, got %s", pages)
+	}
+	if hits := r.List(2); len(hits) != 1 || hits[0].Page != "a" {
+		t.Errorf("unexpected hits %+v", hits)
+	}
+	if hits := r.List(3); hits != nil {
+		t.Errorf("unexpected hits %+v", hits)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
@@ -22,6 +23,69 @@ type Config struct {
 	Logfile          string
 	LogLevel         string `yaml:"log_level"`
 	BotsList         string `yaml:"bots"`
+	Listeners        []Listener
+	Metrics          *Listener // separate listener for prometheus metrics
+	TrustedProxies   []string  `yaml:"trusted_proxies"`
+	Cookieless       bool      // track all sites without cookie
+	Admin            *Admin
+	RateLimit        *RateLimit    `yaml:"rate_limit"`
+	ReferrerList     string        `yaml:"referrer_blocklist"` // spam domains, one per line
+	ReferrerSpam     string        `yaml:"referrer_spam"`      // drop or flag hits from spam domains
+	DailyReset       string        `yaml:"daily_reset"`        // schedule, signal or both, signal by default
+	RenderCache      int           `yaml:"render_cache"`       // number of encoded counters kept in memory
+	SignatureMaxAge  time.Duration `yaml:"signature_max_age"`  // how long signed counter urls are accepted
+	DefaultCounter   int           `yaml:"default_counter"`    // shown for unknown sites, the lowest loaded id when unset
+	HistoryQueue     int           `yaml:"history_queue"`      // hits and events waiting for the history collector
+}
+
+// Daily reset triggers
+const (
+	ResetSchedule = "schedule" // local midnight of database location or site time zone
+	ResetSignal   = "signal"   // SIGHUP
+	ResetBoth     = "both"
+)
+
+// Referrer spam actions
+const (
+	SpamDrop = "drop"
+	SpamFlag = "flag"
+)
+
+// RateLimit configures token buckets hits are taken from, hits over limit are not counted
+type RateLimit struct {
+	IP   Limit
+	Site Limit
+	Size int // max number of tracked ip addresses and sites
+}
+
+// Limit allows burst hits at once and rate hits per second on average, zero rate disables limit
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Admin configures dashboard protected by basic auth or bearer token
+type Admin struct {
+	Listener Listener
+	User     string
+	Password string
+	Token    string
+}
+
+// Listener describes a single endpoint topd accepts connections on
+type Listener struct {
+	Network  string // unix, tcp or tls
+	Address  string
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+// WebListeners returns configured listeners, falling back to the unix socket
+func (c Config) WebListeners() []Listener {
+	if len(c.Listeners) > 0 {
+		return c.Listeners
+	}
+	return []Listener{{Network: "unix", Address: c.Socket}}
 }
 
 //NewConfig config constructor
@@ -45,6 +109,76 @@ func NewConfig(configPath, env string) (Config, error) {
 	if config, ok = configMain[env]; !ok {
 		return Config{}, fmt.Errorf("wrong work environment %s", env)
 	}
+	for _, l := range config.WebListeners() {
+		if err := l.validate(); err != nil {
+			return Config{}, err
+		}
+	}
+	if config.Metrics != nil {
+		if err := config.Metrics.validate(); err != nil {
+			return Config{}, err
+		}
+	}
+	if config.Admin != nil {
+		if err := config.Admin.Listener.validate(); err != nil {
+			return Config{}, err
+		}
+		if config.Admin.Token == "" && (config.Admin.User == "" || config.Admin.Password == "") {
+			return Config{}, errors.New("admin: token or user and password are required")
+		}
+	}
+	switch config.ReferrerSpam {
+	case "":
+		config.ReferrerSpam = SpamDrop
+	case SpamDrop, SpamFlag:
+	default:
+		return Config{}, fmt.Errorf("referrer_spam: unknown action %q", config.ReferrerSpam)
+	}
+	switch config.DailyReset {
+	case "":
+		config.DailyReset = ResetSignal
+	case ResetSchedule, ResetSignal, ResetBoth:
+	default:
+		return Config{}, fmt.Errorf("daily_reset: unknown mode %q", config.DailyReset)
+	}
+	if limit := config.RateLimit; limit != nil {
+		if limit.Size <= 0 {
+			return Config{}, errors.New("rate_limit: size must be positive")
+		}
+		if err := limit.IP.validate(); err != nil {
+			return Config{}, fmt.Errorf("rate_limit: ip: %v", err)
+		}
+		if err := limit.Site.validate(); err != nil {
+			return Config{}, fmt.Errorf("rate_limit: site: %v", err)
+		}
+	}
 	return config, nil
 
 }
+
+// validate rejects limit counting every hit as excess
+func (l Limit) validate() error {
+	if l.Rate < 0 {
+		return errors.New("negative rate")
+	}
+	if l.Rate > 0 && l.Burst < 1 {
+		return errors.New("burst must be at least 1")
+	}
+	return nil
+}
+
+func (l Listener) validate() error {
+	switch l.Network {
+	case "unix", "tcp":
+	case "tls":
+		if l.CertFile == "" || l.KeyFile == "" {
+			return fmt.Errorf("listener %s: cert_file and key_file are required for tls", l.Address)
+		}
+	default:
+		return fmt.Errorf("listener %s: unknown network %q", l.Address, l.Network)
+	}
+	if l.Address == "" {
+		return fmt.Errorf("listener %s: empty address", l.Network)
+	}
+	return nil
+}
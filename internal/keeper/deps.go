@@ -1,8 +1,9 @@
 package keeper
 
 import (
+	"time"
+
 	"github.com/felicson/topd/internal/log"
-	"github.com/felicson/topd/storage"
 )
 
 type Deps interface {
@@ -10,5 +11,8 @@ type Deps interface {
 	GetLogger() log.Logger
 	GetSites() SiteCollector
 	GetStorage() Saver
-	GetTopData() *storage.TopDataCollection
+	GetResetLog() ResetLog
+	GetHistory() History
+	GetLocation() *time.Location
+	GetResetMode() string
 }
@@ -2,35 +2,84 @@ package keeper
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/felicson/topd/internal/config"
 	"github.com/felicson/topd/internal/log"
+	"github.com/felicson/topd/internal/metrics"
 	"github.com/felicson/topd/storage"
 )
 
 type SiteCollector interface {
 	Reset() bool
-	Init()
+	Init() error
 	KeepState() error
+	Timezones() []string
+	ResetTimezone(zone string) []int
 }
 
 type SessionCleaner interface {
 	Reset() error
+	ResetSites(ids []int)
+}
+
+// History hands collected rows and events over to the flush
+type History interface {
+	Take() (storage.TopDataCollection, storage.EventCollection)
+	Restore(storage.TopDataCollection, storage.EventCollection)
 }
 
 type Saver interface {
 	SaveData([]storage.TopData) error
+	SaveEvents([]storage.Event) error
+}
+
+// ResetLog keeps local date of the last daily reset of each zone across restarts
+type ResetLog interface {
+	ResetDays() (map[string]string, error)
+	SetResetDay(zone, day string) error
 }
 
 type Keeper struct {
 	siteCollector SiteCollector
 	sessCleaner   SessionCleaner
-	topData       *storage.TopDataCollection
+	history       History
 	storage       Saver
+	resets        ResetLog
 	logger        log.Logger
+	status        *flushStatus
+	location      *time.Location // zone of daily reset for sites without own one
+	resetMode     string
+	zones         map[string]*time.Location
+	days          map[string]string // local date of the last reset of the zone
+}
+
+// flushStatus keeps result of the last flush
+type flushStatus struct {
+	lock sync.RWMutex
+	at   time.Time
+	err  error
+}
+
+// LastFlush returns time and error of the last flush
+func (k *Keeper) LastFlush() (time.Time, error) {
+	k.status.lock.RLock()
+	defer k.status.lock.RUnlock()
+	return k.status.at, k.status.err
+}
+
+// Ready fails when the last flush failed
+func (k *Keeper) Ready() error {
+	at, err := k.LastFlush()
+	if err != nil {
+		return fmt.Errorf("flush at %s failed: %v", at.Format(time.RFC3339), err)
+	}
+	return nil
 }
 
 func (k *Keeper) Run(ctx context.Context, done chan<- struct{}) {
@@ -41,23 +90,33 @@ func (k *Keeper) Run(ctx context.Context, done chan<- struct{}) {
 	defer close(sigChan)
 	defer ticker.Stop()
 
+	// resetC stays nil and never fires when daily reset is triggered only by signal
+	var (
+		resetTimer *time.Timer
+		resetC     <-chan time.Time
+	)
+	if k.scheduled() {
+		k.loadResetDays()
+		k.dailyReset(time.Now())
+		resetTimer = time.NewTimer(k.nextReset(time.Now()))
+		defer resetTimer.Stop()
+		resetC = resetTimer.C
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
 
 		case sig := <-sigChan:
-			t := (*k.topData)[:len(*k.topData):len(*k.topData)]
-			if err := k.storage.SaveData(t); err != nil {
-				k.logger.Error(err)
-			}
-			if err := k.siteCollector.KeepState(); err != nil {
-				k.logger.Error(err)
-			}
+			k.flush()
 
 			if sig == syscall.SIGHUP {
+				if k.resetMode == config.ResetSchedule {
+					k.logger.Info("SIGHUP reset is disabled, daily reset runs on schedule")
+					continue
+				}
 				k.siteCollector.Reset()
-				*k.topData = (*k.topData)[:0]
 				if err := k.sessCleaner.Reset(); err != nil {
 					k.logger.Error(err)
 				}
@@ -66,27 +125,80 @@ func (k *Keeper) Run(ctx context.Context, done chan<- struct{}) {
 			done <- struct{}{}
 			return
 
+		case <-resetC:
+			k.dailyReset(time.Now())
+			resetTimer.Reset(k.nextReset(time.Now()))
+
 		case <-ticker.C:
-			t := (*k.topData)[:len(*k.topData):len(*k.topData)]
-			*k.topData = (*k.topData)[:0]
-			if err := k.storage.SaveData(t); err != nil {
+			k.flush()
+			if err := k.siteCollector.Init(); err != nil {
 				k.logger.Error(err)
 			}
-			if err := k.siteCollector.KeepState(); err != nil {
-				k.logger.Error(err)
+			if k.scheduled() {
+				// catches zones of new sites and wall clock changes
+				k.dailyReset(time.Now())
 			}
-			k.siteCollector.Init()
 		}
 	}
 }
 
+// flush saves collected history, events and current site counters,
+// rows and events not saved are put back to be saved by the next flush
+func (k *Keeper) flush() error {
+
+	var failed error
+	start := time.Now()
+
+	rows, events := k.history.Take()
+	metrics.FlushRows.WithLabelValues("top_data").Observe(float64(len(rows)))
+	if err := k.storage.SaveData(rows); err != nil {
+		metrics.StorageErrors.WithLabelValues("save_data").Inc()
+		k.logger.Error(err)
+		k.history.Restore(rows, nil)
+		failed = err
+	}
+
+	metrics.FlushRows.WithLabelValues("events").Observe(float64(len(events)))
+	if err := k.storage.SaveEvents(events); err != nil {
+		metrics.StorageErrors.WithLabelValues("save_events").Inc()
+		k.logger.Error(err)
+		k.history.Restore(nil, events)
+		failed = err
+	}
+
+	if err := k.siteCollector.KeepState(); err != nil {
+		metrics.StorageErrors.WithLabelValues("update_sites").Inc()
+		k.logger.Error(err)
+		failed = err
+	}
+
+	metrics.FlushDuration.Observe(time.Since(start).Seconds())
+
+	k.status.lock.Lock()
+	k.status.at = start
+	k.status.err = failed
+	k.status.lock.Unlock()
+	return failed
+}
+
 func New(deps Deps) (Keeper, error) {
 
+	location := deps.GetLocation()
+	if location == nil {
+		location = time.Local
+	}
+
 	return Keeper{
 		siteCollector: deps.GetSites(),
 		sessCleaner:   deps.GetSessionCleaner(),
-		topData:       deps.GetTopData(),
+		history:       deps.GetHistory(),
 		storage:       deps.GetStorage(),
+		resets:        deps.GetResetLog(),
 		logger:        deps.GetLogger(),
+		status:        &flushStatus{},
+		location:      location,
+		resetMode:     deps.GetResetMode(),
+		zones:         make(map[string]*time.Location),
+		days:          make(map[string]string),
 	}, nil
 }
@@ -0,0 +1,68 @@
+package keeper
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/felicson/topd/storage"
+	"go.uber.org/zap"
+)
+
+func TestReady(t *testing.T) {
+	saver := &saverStub{err: errors.New("storage is down")}
+	k := Keeper{
+		siteCollector: &sitesStub{},
+		history:       &storage.HistoryBuffer{},
+		storage:       saver,
+		logger:        zap.NewNop().Sugar(),
+		status:        &flushStatus{},
+	}
+	if err := k.Ready(); err != nil {
+		t.Errorf("ready before the first flush: %v", err)
+	}
+	if err := k.flush(); err == nil {
+		t.Fatal("expected flush error")
+	}
+	if err := k.Ready(); err == nil || !strings.Contains(err.Error(), "storage is down") {
+		t.Errorf("failed flush is not reported: %v", err)
+	}
+	saver.err = nil
+	if err := k.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Ready(); err != nil {
+		t.Errorf("ready after successful flush: %v", err)
+	}
+}
+
+func TestFlushKeepsFailedRows(t *testing.T) {
+	history := &storage.HistoryBuffer{}
+	saver := &saverStub{err: errors.New("storage is down")}
+	k := Keeper{
+		siteCollector: &sitesStub{},
+		history:       history,
+		storage:       saver,
+		logger:        zap.NewNop().Sugar(),
+		status:        &flushStatus{},
+	}
+	history.Restore(storage.TopDataCollection{{SiteID: 1, Page: "/"}}, storage.EventCollection{{SiteID: 1, Name: "signup"}})
+
+	if err := k.flush(); err == nil {
+		t.Fatal("expected flush error")
+	}
+	if history.Len() != 1 {
+		t.Fatalf("rows of failed flush are dropped: %d left", history.Len())
+	}
+
+	saver.err = nil
+	if err := k.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(saver.rows) != 1 || saver.rows[0].Page != "/" || len(saver.events) != 1 {
+		t.Errorf("rows of failed flush are not saved: %+v %+v", saver.rows, saver.events)
+	}
+	if rows, events := history.Take(); len(rows) != 0 || len(events) != 0 {
+		t.Errorf("saved rows are kept: %+v %+v", rows, events)
+	}
+}
@@ -0,0 +1,117 @@
+package keeper
+
+import (
+	"time"
+
+	"github.com/felicson/topd/internal/config"
+	"github.com/felicson/topd/internal/metrics"
+)
+
+// dayFormat identifies local date of the zone
+const dayFormat = "2006-01-02"
+
+// scheduled reports whether daily reset runs at local midnight, it is opt-in
+func (k *Keeper) scheduled() bool {
+	return k.resetMode == config.ResetSchedule || k.resetMode == config.ResetBoth
+}
+
+// zone returns location of the time zone name, empty name is the database location
+func (k *Keeper) zone(name string) *time.Location {
+	if name == "" {
+		return k.location
+	}
+	if loc, ok := k.zones[name]; ok {
+		return loc
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		k.logger.Errorf("on load site time zone, %s is used: %v", k.location, err)
+		loc = k.location
+	}
+	k.zones[name] = loc
+	return loc
+}
+
+func (k *Keeper) zoneNames() []string {
+	return append([]string{""}, k.siteCollector.Timezones()...)
+}
+
+// loadResetDays restores dates of the last resets, so a midnight passed while stopped is caught on start
+func (k *Keeper) loadResetDays() {
+	days, err := k.resets.ResetDays()
+	if err != nil {
+		k.logger.Errorf("on load reset days, zones are reset from the next midnight: %v", err)
+		return
+	}
+	for name, day := range days {
+		k.days[name] = day
+	}
+}
+
+// setResetDay remembers date of the zone reset
+func (k *Keeper) setResetDay(name, day string) {
+	k.days[name] = day
+	if err := k.resets.SetResetDay(name, day); err != nil {
+		k.logger.Error(err)
+	}
+}
+
+// dailyReset flushes collected data and resets sites of every zone
+// where local date has changed since the last reset. Zones seen for the first time
+// are only recorded. Reset is postponed when the flush fails and retried on the next call.
+func (k *Keeper) dailyReset(now time.Time) {
+
+	var due []string
+	for _, name := range k.zoneNames() {
+		day := now.In(k.zone(name)).Format(dayFormat)
+		prev, ok := k.days[name]
+		if !ok {
+			k.setResetDay(name, day)
+			continue
+		}
+		if prev != day {
+			due = append(due, name)
+		}
+	}
+	if len(due) == 0 {
+		return
+	}
+
+	if err := k.flush(); err != nil {
+		k.logger.Errorf("daily reset of %d zones is postponed after failed flush: %v", len(due), err)
+		return
+	}
+	for _, name := range due {
+		ids := k.siteCollector.ResetTimezone(name)
+		k.sessCleaner.ResetSites(ids)
+		k.setResetDay(name, now.In(k.zone(name)).Format(dayFormat))
+
+		zone := k.zone(name).String()
+		metrics.DailyResets.WithLabelValues(zone).Inc()
+		k.logger.Infof("daily reset of %d sites in %s", len(ids), zone)
+	}
+}
+
+// nextReset returns duration until the nearest local midnight among all zones
+func (k *Keeper) nextReset(now time.Time) time.Duration {
+
+	var next time.Time
+	for _, name := range k.zoneNames() {
+		if m := nextMidnight(now, k.zone(name)); next.IsZero() || m.Before(next) {
+			next = m
+		}
+	}
+	return next.Sub(now)
+}
+
+// nextMidnight returns the first instant of the next local day
+func nextMidnight(now time.Time, loc *time.Location) time.Time {
+
+	y, m, d := now.In(loc).Date()
+	next := time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+	if ny, nm, nd := next.In(loc).Date(); ny == y && nm == m && nd == d {
+		// midnight is skipped by DST change, the day starts with the clock moved forward
+		next = next.Add(time.Hour)
+	}
+	return next
+}
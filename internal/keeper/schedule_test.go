@@ -0,0 +1,199 @@
+package keeper
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/felicson/topd/internal/config"
+	"github.com/felicson/topd/storage"
+	"go.uber.org/zap"
+)
+
+func TestNextMidnight(t *testing.T) {
+	saoPaulo, err := time.LoadLocation("America/Sao_Paulo")
+	if err != nil {
+		t.Skip(err)
+	}
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+
+	for _, c := range []struct {
+		now  time.Time
+		next time.Time
+	}{
+		{time.Date(2024, 5, 1, 13, 0, 0, 0, berlin), time.Date(2024, 5, 2, 0, 0, 0, 0, berlin)},
+		// 23 hours day
+		{time.Date(2024, 3, 31, 1, 0, 0, 0, berlin), time.Date(2024, 4, 1, 0, 0, 0, 0, berlin)},
+		// 25 hours day
+		{time.Date(2024, 10, 27, 1, 0, 0, 0, berlin), time.Date(2024, 10, 28, 0, 0, 0, 0, berlin)},
+		// midnight was skipped, the day started at 01:00 -02
+		{time.Date(2018, 11, 3, 12, 0, 0, 0, saoPaulo), time.Date(2018, 11, 4, 3, 0, 0, 0, time.UTC)},
+	} {
+		next := nextMidnight(c.now, c.now.Location())
+		if !next.Equal(c.next) {
+			t.Errorf("%s: expected %s, got %s", c.now, c.next, next)
+		}
+		if y, m, d := next.In(c.now.Location()).Date(); d == c.now.Day() {
+			t.Errorf("%s: next midnight %d-%d-%d is the same day", c.now, y, m, d)
+		}
+	}
+}
+
+type sitesStub struct {
+	zones []string
+	reset []string
+}
+
+func (s *sitesStub) Reset() bool         { return true }
+func (s *sitesStub) Init() error         { return nil }
+func (s *sitesStub) KeepState() error    { return nil }
+func (s *sitesStub) Timezones() []string { return s.zones }
+func (s *sitesStub) ResetTimezone(zone string) []int {
+	s.reset = append(s.reset, zone)
+	return []int{1}
+}
+
+type sessionsStub struct {
+	reset int
+}
+
+func (s *sessionsStub) Reset() error         { return nil }
+func (s *sessionsStub) ResetSites(ids []int) { s.reset += len(ids) }
+
+type saverStub struct {
+	err    error
+	rows   []storage.TopData
+	events []storage.Event
+}
+
+func (s *saverStub) SaveData(rows []storage.TopData) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.rows = append(s.rows, rows...)
+	return nil
+}
+
+func (s *saverStub) SaveEvents(events []storage.Event) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.events = append(s.events, events...)
+	return nil
+}
+
+type resetLogStub map[string]string
+
+func (r resetLogStub) ResetDays() (map[string]string, error) {
+	days := make(map[string]string)
+	for zone, day := range r {
+		days[zone] = day
+	}
+	return days, nil
+}
+
+func (r resetLogStub) SetResetDay(zone, day string) error {
+	r[zone] = day
+	return nil
+}
+
+func TestScheduled(t *testing.T) {
+	for mode, scheduled := range map[string]bool{
+		"":                   false,
+		config.ResetSignal:   false,
+		config.ResetSchedule: true,
+		config.ResetBoth:     true,
+	} {
+		k := Keeper{resetMode: mode}
+		if k.scheduled() != scheduled {
+			t.Errorf("%q: expected scheduled %v", mode, scheduled)
+		}
+	}
+}
+
+func TestDailyReset(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Skip(err)
+	}
+	sites := &sitesStub{zones: []string{"America/New_York"}}
+	sessions := &sessionsStub{}
+	resets := resetLogStub{}
+	k := Keeper{
+		siteCollector: sites,
+		sessCleaner:   sessions,
+		history:       &storage.HistoryBuffer{},
+		storage:       &saverStub{},
+		resets:        resets,
+		logger:        zap.NewNop().Sugar(),
+		status:        &flushStatus{},
+		location:      moscow,
+		resetMode:     config.ResetSchedule,
+		zones:         make(map[string]*time.Location),
+		days:          make(map[string]string),
+	}
+
+	// 23:30 in Moscow, 15:30 in New York
+	start := time.Date(2026, 1, 10, 20, 30, 0, 0, time.UTC)
+	k.dailyReset(start)
+	if len(sites.reset) != 0 {
+		t.Fatalf("reset on the first check: %v", sites.reset)
+	}
+	if resets[""] != "2026-01-10" || resets["America/New_York"] != "2026-01-10" {
+		t.Errorf("first check is not recorded: %v", resets)
+	}
+	if d := k.nextReset(start); d != 30*time.Minute {
+		t.Errorf("unexpected next reset in %s", d)
+	}
+
+	k.dailyReset(start.Add(31 * time.Minute))
+	if len(sites.reset) != 1 || sites.reset[0] != "" || sessions.reset != 1 {
+		t.Fatalf("expected reset of default zone, got %v", sites.reset)
+	}
+
+	k.dailyReset(start.Add(9 * time.Hour))
+	if len(sites.reset) != 2 || sites.reset[1] != "America/New_York" {
+		t.Errorf("expected reset of site zone, got %v", sites.reset)
+	}
+	if status := k.status; status.at.IsZero() {
+		t.Error("reset is done without flush")
+	}
+	if resets[""] != "2026-01-11" || resets["America/New_York"] != "2026-01-11" {
+		t.Errorf("reset days are not saved: %v", resets)
+	}
+}
+
+func TestDailyResetOnStart(t *testing.T) {
+	sites := &sitesStub{}
+	saver := &saverStub{err: errors.New("storage is down")}
+	k := Keeper{
+		siteCollector: sites,
+		sessCleaner:   &sessionsStub{},
+		history:       &storage.HistoryBuffer{},
+		storage:       saver,
+		resets:        resetLogStub{"": "2026-01-09"},
+		logger:        zap.NewNop().Sugar(),
+		status:        &flushStatus{},
+		location:      time.UTC,
+		resetMode:     config.ResetSchedule,
+		zones:         make(map[string]*time.Location),
+		days:          make(map[string]string),
+	}
+	k.loadResetDays()
+
+	now := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	k.dailyReset(now)
+	if len(sites.reset) != 0 {
+		t.Fatalf("reset after failed flush: %v", sites.reset)
+	}
+
+	saver.err = nil
+	k.dailyReset(now.Add(10 * time.Second))
+	if len(sites.reset) != 1 || sites.reset[0] != "" {
+		t.Fatalf("midnight passed while stopped is not caught: %v", sites.reset)
+	}
+	k.dailyReset(now.Add(20 * time.Second))
+	if len(sites.reset) != 1 {
+		t.Errorf("zone is reset twice a day: %v", sites.reset)
+	}
+}
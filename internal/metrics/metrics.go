@@ -0,0 +1,66 @@
+// Package metrics defines topd prometheus metrics, all of them are registered in Registry at init
+package metrics
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// DefBuckets are default latency buckets in seconds
+var DefBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5}
+
+// Registry holds topd metrics together with go runtime and process ones
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+func init() {
+	Registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler exposes registered metrics in the text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// GaugeFunc is gauge registered at init reporting value of the function set by the measured component,
+// it is zero until the function is set
+type GaugeFunc struct {
+	fn atomic.Value // func() float64
+}
+
+func newGaugeFunc(opts prometheus.GaugeOpts) *GaugeFunc {
+	g := &GaugeFunc{}
+	factory.NewGaugeFunc(opts, g.value)
+	return g
+}
+
+// Set replaces function called on every scrape
+func (g *GaugeFunc) Set(fn func() float64) {
+	g.fn.Store(fn)
+}
+
+func (g *GaugeFunc) value() float64 {
+	fn, _ := g.fn.Load().(func() float64)
+	if fn == nil {
+		return 0
+	}
+	return fn()
+}
+
+// Value returns current value of the counter
+func Value(c prometheus.Counter) float64 {
+	var m dto.Metric
+	if err := c.Write(&m); err != nil {
+		return 0
+	}
+	return m.GetCounter().GetValue()
+}
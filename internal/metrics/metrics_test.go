@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	// counters are global and keep values of previous runs, deltas are checked
+	hits, saveErrors := Value(Hits), Value(StorageErrors.WithLabelValues("save_data"))
+
+	RenderCacheEntries.Set(func() float64 { return 3 })
+	// function may be replaced, gauge is registered once at init
+	RenderCacheEntries.Set(func() float64 { return 4 })
+	StorageErrors.WithLabelValues("save_data").Inc()
+	Hits.Add(2)
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(rec.Body)
+	for _, line := range []string{
+		"topd_render_cache_entries 4",
+		`topd_storage_errors_total{op="save_data"} `,
+		`topd_history_collector_queue_length{queue="events"} 0`,
+		`topd_history_collector_queue_length{queue="hits"} 0`,
+		"go_goroutines ",
+	} {
+		if !strings.Contains(string(body), line) {
+			t.Errorf("%q is missing in:\n%s", line, body)
+		}
+	}
+	if v := Value(Hits) - hits; v != 2 {
+		t.Errorf("unexpected hits delta %v", v)
+	}
+	if v := Value(StorageErrors.WithLabelValues("save_data")) - saveErrors; v != 1 {
+		t.Errorf("unexpected storage errors delta %v", v)
+	}
+}
@@ -0,0 +1,60 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// topd metrics registered in Registry
+var (
+	HTTPRequests = factory.NewCounterVec(prometheus.CounterOpts{Name: "topd_http_requests_total",
+		Help: "Count of http requests by handler and status code."}, []string{"handler", "code"})
+	HTTPDuration = factory.NewHistogramVec(prometheus.HistogramOpts{Name: "topd_http_request_duration_seconds",
+		Help: "Http request latency by handler.", Buckets: DefBuckets}, []string{"handler"})
+
+	FlushRows = factory.NewHistogramVec(prometheus.HistogramOpts{Name: "topd_keeper_flush_rows",
+		Help: "Rows saved by a single keeper flush.", Buckets: []float64{0, 10, 100, 1000, 10000, 100000}}, []string{"kind"})
+	DailyResets = factory.NewCounterVec(prometheus.CounterOpts{Name: "topd_keeper_daily_resets_total",
+		Help: "Scheduled daily resets by time zone."}, []string{"zone"})
+	FlushDuration = factory.NewHistogram(prometheus.HistogramOpts{Name: "topd_keeper_flush_duration_seconds",
+		Help: "Duration of keeper flush.", Buckets: DefBuckets})
+	StorageErrors = factory.NewCounterVec(prometheus.CounterOpts{Name: "topd_storage_errors_total",
+		Help: "Count of failed storage operations."}, []string{"op"})
+
+	Hits = factory.NewCounter(prometheus.CounterOpts{Name: "topd_hits_total",
+		Help: "Hits processed by the counter."})
+	Events = factory.NewCounter(prometheus.CounterOpts{Name: "topd_events_total",
+		Help: "Events processed by the event endpoint."})
+	BotRejections = factory.NewCounterVec(prometheus.CounterOpts{Name: "topd_bot_rejections_total",
+		Help: "Hits and events not counted because of bot user agent."}, []string{"path"})
+	RateLimited = factory.NewCounter(prometheus.CounterOpts{Name: "topd_rate_limited_total",
+		Help: "Hits not counted because of rate limit."})
+	ReferrerSpam = factory.NewCounter(prometheus.CounterOpts{Name: "topd_referrer_spam_total",
+		Help: "Hits with blocklisted referrer."})
+	ForeignHits = factory.NewCounter(prometheus.CounterOpts{Name: "topd_foreign_hits_total",
+		Help: "Hits not counted because referer or page domain is not allowed for the site."})
+	SignatureRejections = factory.NewCounter(prometheus.CounterOpts{Name: "topd_signature_rejections_total",
+		Help: "Counter requests rejected because of missing or wrong signature."})
+	UnknownSites = factory.NewCounter(prometheus.CounterOpts{Name: "topd_unknown_site_total",
+		Help: "Requests with unknown site id."})
+	LiveDropped = factory.NewCounter(prometheus.CounterOpts{Name: "topd_live_dropped_total",
+		Help: "Hits dropped for slow live stream subscribers."})
+	Reloads = factory.NewCounterVec(prometheus.CounterOpts{Name: "topd_reloads_total",
+		Help: "Configuration reloads by result."}, []string{"result"})
+	ImageRender = factory.NewHistogram(prometheus.HistogramOpts{Name: "topd_image_render_seconds",
+		Help: "Counter image render time.", Buckets: DefBuckets})
+	RenderCacheMisses = factory.NewCounter(prometheus.CounterOpts{Name: "topd_render_cache_misses_total",
+		Help: "Counters rendered because they were not cached."})
+
+	LiveSubscribers = newGaugeFunc(prometheus.GaugeOpts{Name: "topd_live_subscribers",
+		Help: "Connected live stream subscribers."})
+	RenderCacheEntries = newGaugeFunc(prometheus.GaugeOpts{Name: "topd_render_cache_entries",
+		Help: "Encoded counters kept in memory."})
+
+	// history collector queues of hits and events
+	HitsQueueLength = newGaugeFunc(prometheus.GaugeOpts{Name: "topd_history_collector_queue_length",
+		Help: "Items waiting in the history collector queue.", ConstLabels: prometheus.Labels{"queue": "hits"}})
+	EventsQueueLength = newGaugeFunc(prometheus.GaugeOpts{Name: "topd_history_collector_queue_length",
+		Help: "Items waiting in the history collector queue.", ConstLabels: prometheus.Labels{"queue": "events"}})
+	HitsQueueCapacity = newGaugeFunc(prometheus.GaugeOpts{Name: "topd_history_collector_queue_capacity",
+		Help: "History collector queue capacity.", ConstLabels: prometheus.Labels{"queue": "hits"}})
+	EventsQueueCapacity = newGaugeFunc(prometheus.GaugeOpts{Name: "topd_history_collector_queue_capacity",
+		Help: "History collector queue capacity.", ConstLabels: prometheus.Labels{"queue": "events"}})
+)
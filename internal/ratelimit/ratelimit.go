@@ -0,0 +1,76 @@
+// Package ratelimit implements token bucket limits for many keys with bounded memory
+package ratelimit
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Limiter keeps a token bucket per key, the least recently used keys are evicted
+// when number of buckets exceeds size
+type Limiter struct {
+	lock    sync.Mutex
+	rate    float64 // tokens per second
+	burst   float64
+	size    int
+	buckets map[string]*list.Element
+	order   *list.List // front is the most recently used
+}
+
+type bucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+// New creates limiter refilling rate tokens per second up to burst for at most size keys
+func New(rate float64, burst, size int) *Limiter {
+	return &Limiter{
+		rate:    rate,
+		burst:   float64(burst),
+		size:    size,
+		buckets: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Allow takes a token from the key bucket and reports whether it was available
+func (l *Limiter) Allow(key string, now time.Time) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	el, ok := l.buckets[key]
+	if !ok {
+		if l.order.Len() >= l.size {
+			oldest := l.order.Back()
+			l.order.Remove(oldest)
+			delete(l.buckets, oldest.Value.(*bucket).key)
+		}
+		el = l.order.PushFront(&bucket{key: key, tokens: l.burst, last: now})
+		l.buckets[key] = el
+	} else {
+		l.order.MoveToFront(el)
+	}
+
+	b := el.Value.(*bucket)
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * l.rate
+		if b.tokens > l.burst {
+			b.tokens = l.burst
+		}
+		b.last = now
+	}
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Len returns number of tracked keys
+func (l *Limiter) Len() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.order.Len()
+}
@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAllow(t *testing.T) {
+	l := New(1, 3, 10)
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if !l.Allow("a", now) {
+			t.Fatalf("hit %d rejected within burst", i)
+		}
+	}
+	if l.Allow("a", now) {
+		t.Error("hit over burst allowed")
+	}
+	if !l.Allow("b", now) {
+		t.Error("other key is limited")
+	}
+	if !l.Allow("a", now.Add(time.Second)) {
+		t.Error("bucket is not refilled")
+	}
+	if l.Allow("a", now.Add(time.Second)) {
+		t.Error("bucket refilled over rate")
+	}
+	// long idle period must not exceed burst
+	for i := 0; i < 3; i++ {
+		l.Allow("a", now.Add(time.Hour))
+	}
+	if l.Allow("a", now.Add(time.Hour)) {
+		t.Error("bucket refilled over burst")
+	}
+}
+
+func TestEviction(t *testing.T) {
+	l := New(0, 1, 2)
+	now := time.Now()
+
+	l.Allow("a", now)
+	l.Allow("b", now)
+	l.Allow("a", now)
+	l.Allow("c", now) // evicts b as least recently used
+
+	if l.Len() != 2 {
+		t.Fatalf("unexpected size %d", l.Len())
+	}
+	if !l.Allow("b", now) {
+		t.Error("evicted key starts with full bucket")
+	}
+	if l.Allow("c", now) {
+		t.Error("recent key is evicted")
+	}
+}
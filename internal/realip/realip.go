@@ -0,0 +1,133 @@
+// Package realip resolves client address behind trusted reverse proxies
+package realip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Resolver takes forwarding headers into account only for trusted peers.
+// Connections over unix socket are always made by a local proxy and trusted.
+type Resolver struct {
+	trusted []*net.IPNet
+}
+
+// NewResolver parses list of trusted proxy networks, single addresses are accepted too
+func NewResolver(proxies []string) (Resolver, error) {
+
+	var r Resolver
+	for _, p := range proxies {
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return Resolver{}, fmt.Errorf("wrong trusted proxy %q", p)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			r.trusted = append(r.trusted, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(p)
+		if err != nil {
+			return Resolver{}, fmt.Errorf("wrong trusted proxy %q: %v", p, err)
+		}
+		r.trusted = append(r.trusted, network)
+	}
+	return r, nil
+}
+
+// ClientIP returns client address of the request, nil when it is unknown
+func (r Resolver) ClientIP(req *http.Request) net.IP {
+
+	peer, unix := peerIP(req.RemoteAddr)
+	if !unix && !r.isTrusted(peer) {
+		return peer
+	}
+
+	if chain := forwardedFor(req.Header); len(chain) > 0 {
+		return r.fromChain(chain, peer)
+	}
+	if ip := net.ParseIP(strings.TrimSpace(req.Header.Get("X-Real-IP"))); ip != nil {
+		return ip
+	}
+	return peer
+}
+
+// fromChain walks proxy chain from the nearest hop and returns the first untrusted address
+func (r Resolver) fromChain(chain []string, peer net.IP) net.IP {
+
+	client := peer
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip := parseHost(chain[i])
+		if ip == nil {
+			break
+		}
+		client = ip
+		if !r.isTrusted(ip) {
+			break
+		}
+	}
+	return client
+}
+
+func (r Resolver) isTrusted(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range r.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedFor returns proxy chain from X-Forwarded-For or Forwarded headers
+func forwardedFor(h http.Header) []string {
+
+	var chain []string
+	for _, v := range h.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(v, ",") {
+			chain = append(chain, strings.TrimSpace(hop))
+		}
+	}
+	if len(chain) > 0 {
+		return chain
+	}
+
+	for _, v := range h.Values("Forwarded") {
+		for _, element := range strings.Split(v, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+				if len(kv) == 2 && strings.EqualFold(kv[0], "for") {
+					chain = append(chain, strings.Trim(kv[1], `"`))
+				}
+			}
+		}
+	}
+	return chain
+}
+
+// parseHost parses address with optional port, IPv6 may be in brackets
+func parseHost(hop string) net.IP {
+	if ip := net.ParseIP(hop); ip != nil {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(hop); err == nil {
+		return net.ParseIP(host)
+	}
+	return net.ParseIP(strings.Trim(hop, "[]"))
+}
+
+// peerIP returns address of the connection peer and whether it is unix socket
+func peerIP(remoteAddr string) (net.IP, bool) {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return nil, true
+	}
+	return net.ParseIP(host), false
+}
@@ -0,0 +1,50 @@
+package realip
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	r, err := NewResolver([]string{"10.0.0.0/8", "192.168.1.1", "2001:db8::/32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		ip      string
+	}{
+		{"untrusted peer", "1.2.3.4:1000", map[string]string{"X-Real-IP": "5.5.5.5", "X-Forwarded-For": "6.6.6.6"}, "1.2.3.4"},
+		{"trusted peer without headers", "10.0.0.1:1000", nil, "10.0.0.1"},
+		{"real ip", "192.168.1.1:1000", map[string]string{"X-Real-IP": "5.5.5.5"}, "5.5.5.5"},
+		{"forwarded for chain", "10.0.0.1:1000", map[string]string{"X-Forwarded-For": "7.7.7.7, 6.6.6.6, 10.1.1.1"}, "6.6.6.6"},
+		{"all hops trusted", "10.0.0.1:1000", map[string]string{"X-Forwarded-For": "10.2.2.2, 10.1.1.1"}, "10.2.2.2"},
+		{"forwarded header", "10.0.0.1:1000", map[string]string{"Forwarded": `for=7.7.7.7;proto=https, for="[2001:db8::1]:4711"`}, "7.7.7.7"},
+		{"forwarded for over real ip", "10.0.0.1:1000", map[string]string{"X-Forwarded-For": "6.6.6.6", "X-Real-IP": "5.5.5.5"}, "6.6.6.6"},
+		{"unix socket", "@", map[string]string{"X-Real-IP": "5.5.5.5"}, "5.5.5.5"},
+		{"garbage hop", "10.0.0.1:1000", map[string]string{"X-Forwarded-For": "6.6.6.6, unknown"}, "10.0.0.1"},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "/top/?id=1", nil)
+		req.RemoteAddr = c.remote
+		for k, v := range c.headers {
+			req.Header.Set(k, v)
+		}
+		if ip := r.ClientIP(req); ip.String() != c.ip {
+			t.Errorf("%s: expected %s, got %s", c.name, c.ip, ip)
+		}
+	}
+}
+
+func TestNewResolver(t *testing.T) {
+	if _, err := NewResolver([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("expected error on wrong network")
+	}
+	if _, err := NewResolver([]string{"localhost"}); err == nil {
+		t.Error("expected error on host name")
+	}
+}
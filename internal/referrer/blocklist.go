@@ -0,0 +1,129 @@
+// Package referrer detects referrer spam by domain blocklist
+package referrer
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Blocklist matches referrers of listed domains and their subdomains,
+// it is loaded again from file when the file changes, see Changed
+type Blocklist struct {
+	file    string
+	lock    sync.RWMutex
+	domains map[string]struct{}
+	modTime time.Time
+}
+
+// NewBlocklistFromFile loads domains from file, one per line, # starts a comment
+func NewBlocklistFromFile(file string) (*Blocklist, error) {
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("on open file: %v", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("on stat file: %v", err)
+	}
+
+	domains := make(map[string]struct{})
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimLeft(strings.TrimSpace(line), "*.")
+		if line != "" {
+			domains[strings.ToLower(line)] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("on scan referrers: %v", err)
+	}
+	return &Blocklist{file: file, domains: domains, modTime: info.ModTime()}, nil
+}
+
+// Load reads the file into new blocklist leaving current domains as is, see Replace
+func (b *Blocklist) Load() (*Blocklist, error) {
+	return NewBlocklistFromFile(b.file)
+}
+
+// Replace swaps current domains with domains of other blocklist
+func (b *Blocklist) Replace(other *Blocklist) {
+	other.lock.RLock()
+	domains, modTime := other.domains, other.modTime
+	other.lock.RUnlock()
+
+	b.lock.Lock()
+	b.domains = domains
+	b.modTime = modTime
+	b.lock.Unlock()
+}
+
+// Reload reads the file replacing current domains
+func (b *Blocklist) Reload() error {
+	loaded, err := b.Load()
+	if err != nil {
+		return err
+	}
+	b.Replace(loaded)
+	return nil
+}
+
+// Changed reports whether modification time of the file differs from the loaded one
+func (b *Blocklist) Changed() (bool, error) {
+	info, err := os.Stat(b.file)
+	if err != nil {
+		return false, fmt.Errorf("on stat file: %v", err)
+	}
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return !info.ModTime().Equal(b.modTime), nil
+}
+
+// Blocked reports whether the referrer host or any of its parent domains is listed
+func (b *Blocklist) Blocked(referrer string) bool {
+
+	host := Host(referrer)
+	if host == "" {
+		return false
+	}
+
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	for {
+		if _, ok := b.domains[host]; ok {
+			return true
+		}
+		i := strings.IndexByte(host, '.')
+		if i < 0 {
+			return false
+		}
+		host = host[i+1:]
+	}
+}
+
+// Host extracts lower cased host name from referrer url, scheme may be omitted
+func Host(referrer string) string {
+	if referrer == "" {
+		return ""
+	}
+	if !strings.Contains(referrer, "://") {
+		referrer = "http://" + referrer
+	}
+	u, err := url.Parse(referrer)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+}
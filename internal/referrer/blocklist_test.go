@@ -0,0 +1,63 @@
+package referrer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBlocked(t *testing.T) {
+	dir, err := ioutil.TempDir("", "referrer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "spam.txt")
+	if err := ioutil.WriteFile(file, []byte("# spammers\nSpam.example\n*.seo.test # wildcard\n\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewBlocklistFromFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for ref, blocked := range map[string]bool{
+		"https://spam.example/page":      true,
+		"http://www.SPAM.example.:8080/": true,
+		"cheap.seo.test/x":               true,
+		"https://seo.test":               true,
+		"https://notspam.example/":       false,
+		"https://spam.example.org/":      false,
+		"":                               false,
+	} {
+		if got := b.Blocked(ref); got != blocked {
+			t.Errorf("%q: expected %v, got %v", ref, blocked, got)
+		}
+	}
+
+	if changed, err := b.Changed(); err != nil || changed {
+		t.Errorf("unchanged file: unexpected %v %v", changed, err)
+	}
+	if err := ioutil.WriteFile(file, []byte("other.example\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(file, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := b.Changed(); err != nil || !changed {
+		t.Errorf("changed file: unexpected %v %v", changed, err)
+	}
+	if err := b.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if b.Blocked("https://spam.example/") || !b.Blocked("https://other.example/") {
+		t.Error("blocklist is not reloaded")
+	}
+	if changed, err := b.Changed(); err != nil || changed {
+		t.Errorf("reloaded file: unexpected %v %v", changed, err)
+	}
+}
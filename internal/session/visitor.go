@@ -0,0 +1,77 @@
+package session
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const visitorKeyLen = 16
+
+// DailyHasher builds anonymous visitor keys with a secret salt rotated every day.
+// The salt is kept only in memory, so keys of previous days can not be restored.
+// Each time zone has own salt rotated at its local midnight, together with daily stats of its sites.
+type DailyHasher struct {
+	lock     sync.Mutex
+	location *time.Location
+	zones    map[string]*daySalt
+	now      func() time.Time
+}
+
+type daySalt struct {
+	location *time.Location
+	day      string
+	salt     []byte
+}
+
+// NewDailyHasher creates hasher rotating the salt at midnight in the location
+// for sites without own time zone
+func NewDailyHasher(location *time.Location) *DailyHasher {
+	return &DailyHasher{location: location, zones: make(map[string]*daySalt), now: time.Now}
+}
+
+// Key returns visitor key of siteID, ip and userAgent for the current day of the zone,
+// empty or unknown zone falls back to the hasher location
+func (h *DailyHasher) Key(siteID int, zone string, ip net.IP, userAgent string) string {
+
+	mac := hmac.New(sha256.New, h.currentSalt(zone))
+	mac.Write([]byte(strconv.Itoa(siteID)))
+	mac.Write([]byte{0})
+	mac.Write(ip)
+	mac.Write([]byte{0})
+	mac.Write([]byte(userAgent))
+
+	return hex.EncodeToString(mac.Sum(nil))[:visitorKeyLen]
+}
+
+func (h *DailyHasher) currentSalt(zone string) []byte {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	z, ok := h.zones[zone]
+	if !ok {
+		z = &daySalt{location: h.location}
+		if zone != "" {
+			if loc, err := time.LoadLocation(zone); err == nil {
+				z.location = loc
+			}
+		}
+		h.zones[zone] = z
+	}
+
+	day := h.now().In(z.location).Format("2006-01-02")
+	if day != z.day {
+		salt := make([]byte, sha256.Size)
+		if _, err := rand.Read(salt); err != nil {
+			panic("session: on read random salt: " + err.Error())
+		}
+		z.salt = salt
+		z.day = day
+	}
+	return z.salt
+}
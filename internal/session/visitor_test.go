@@ -0,0 +1,59 @@
+package session
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDailyHasher(t *testing.T) {
+	now := time.Date(2022, 4, 11, 10, 0, 0, 0, time.UTC)
+	h := NewDailyHasher(time.UTC)
+	h.now = func() time.Time { return now }
+
+	ip := net.ParseIP("1.2.3.4")
+	key := h.Key(1, "", ip, "ua")
+
+	if len(key) != visitorKeyLen {
+		t.Fatalf("unexpected key length %d", len(key))
+	}
+	if h.Key(1, "", ip, "ua") != key {
+		t.Error("key changed within the day")
+	}
+	if h.Key(2, "", ip, "ua") == key || h.Key(1, "", net.ParseIP("1.2.3.5"), "ua") == key || h.Key(1, "", ip, "ua2") == key {
+		t.Error("key does not depend on site, ip and user agent")
+	}
+
+	now = now.Add(24 * time.Hour)
+	if h.Key(1, "", ip, "ua") == key {
+		t.Error("key was not rotated on the next day")
+	}
+}
+
+func TestDailyHasherZones(t *testing.T) {
+	if _, err := time.LoadLocation("Asia/Tokyo"); err != nil {
+		t.Skip(err)
+	}
+	// 19:00 in Tokyo
+	now := time.Date(2022, 4, 11, 10, 0, 0, 0, time.UTC)
+	h := NewDailyHasher(time.UTC)
+	h.now = func() time.Time { return now }
+	ip := net.ParseIP("1.2.3.4")
+
+	utc, tokyo := h.Key(1, "", ip, "ua"), h.Key(1, "Asia/Tokyo", ip, "ua")
+	if utc == tokyo {
+		t.Error("zones share the salt")
+	}
+	if h.Key(1, "Not/AZone", ip, "ua") == utc {
+		t.Error("unknown zone shares the salt of default zone")
+	}
+
+	// Tokyo midnight has passed, UTC one has not
+	now = now.Add(13 * time.Hour)
+	if h.Key(1, "", ip, "ua") != utc {
+		t.Error("key of default zone was rotated before its midnight")
+	}
+	if h.Key(1, "Asia/Tokyo", ip, "ua") == tokyo {
+		t.Error("key was not rotated at midnight of the zone")
+	}
+}
@@ -0,0 +1,94 @@
+// Package sign issues and verifies HMAC signatures of counter urls
+package sign
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Param is the query parameter carrying signature
+const Param = "sig"
+
+// TimeParam is the query parameter carrying unix time the signature was issued at
+const TimeParam = "ts"
+
+// Params are counter parameters covered by signature in canonical order,
+// page dependent ones like p, ref and t are not signed
+var Params = []string{"id", "mode", "format", TimeParam}
+
+// maxSkew tolerates clock difference of the host issuing signatures
+const maxSkew = time.Minute
+
+// sigLen is number of hex chars of HMAC-SHA256 kept in signature
+const sigLen = 32
+
+// Canonical returns signed parameters of the query in fixed order, absent ones are skipped
+func Canonical(query url.Values) string {
+	var b strings.Builder
+	for _, name := range Params {
+		v := query.Get(name)
+		if v == "" {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte('&')
+		}
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(url.QueryEscape(v))
+	}
+	return b.String()
+}
+
+// Sign returns signature of the query made with hex encoded secret
+func Sign(secret string, query url.Values) (string, error) {
+	key, err := hex.DecodeString(secret)
+	if err != nil {
+		return "", fmt.Errorf("on decode secret: %v", err)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(Canonical(query)))
+	return hex.EncodeToString(mac.Sum(nil))[:sigLen], nil
+}
+
+// Stamp sets issue time of the signature to the query, it must be called before Sign
+func Stamp(query url.Values, now time.Time) {
+	query.Set(TimeParam, strconv.FormatInt(now.Unix(), 10))
+}
+
+// Verify reports whether the query carries valid signature issued not earlier than maxAge before now.
+// Signatures never expire when maxAge is not positive, issue time is optional then
+// and is checked only by the signature when present.
+func Verify(secret string, query url.Values, now time.Time, maxAge time.Duration) bool {
+	if maxAge > 0 {
+		ts, err := strconv.ParseInt(query.Get(TimeParam), 10, 64)
+		if err != nil {
+			return false
+		}
+		issued := time.Unix(ts, 0)
+		if issued.Before(now.Add(-maxAge)) || issued.After(now.Add(maxSkew)) {
+			return false
+		}
+	}
+	expected, err := Sign(secret, query)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal([]byte(expected), []byte(query.Get(Param)))
+}
+
+// NewSecret generates random hex encoded secret
+func NewSecret() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("on read random: %v", err)
+	}
+	return hex.EncodeToString(key), nil
+}
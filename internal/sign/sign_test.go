@@ -0,0 +1,79 @@
+package sign
+
+import (
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	query := url.Values{"id": {"1"}, "mode": {"pixel"}}
+	Stamp(query, now)
+	sig, err := Sign(secret, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := query.Get(TimeParam)
+
+	signed, _ := url.ParseQuery("mode=pixel&p=https%3A%2F%2Fexample.com%2F&id=1&fw=1&ts=" + ts + "&sig=" + sig)
+	if !Verify(secret, signed, now, time.Hour) {
+		t.Error("valid signature is rejected")
+	}
+	if Verify(secret, signed, now.Add(2*time.Hour), time.Hour) {
+		t.Error("expired signature is accepted")
+	}
+	if Verify(secret, signed, now.Add(-2*maxSkew), time.Hour) {
+		t.Error("signature issued in the future is accepted")
+	}
+
+	later := strconv.FormatInt(now.Unix()+1, 10)
+	for _, raw := range []string{
+		"id=1&mode=pixel&ts=" + ts,
+		"id=2&mode=pixel&ts=" + ts + "&sig=" + sig,
+		"id=1&ts=" + ts + "&sig=" + sig,
+		"id=1&mode=pixel&ts=" + ts + "&sig=" + sig[1:],
+		"id=1&mode=pixel&sig=" + sig,
+		"id=1&mode=pixel&ts=" + later + "&sig=" + sig,
+	} {
+		query, _ := url.ParseQuery(raw)
+		if Verify(secret, query, now, time.Hour) {
+			t.Errorf("%s: forged signature is accepted", raw)
+		}
+	}
+
+	// without max age issue time is optional but still signed
+	if !Verify(secret, signed, now.Add(48*time.Hour), 0) {
+		t.Error("signature without max age is expired")
+	}
+	unstamped := url.Values{"id": {"1"}, "mode": {"pixel"}}
+	sig, err = Sign(secret, unstamped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unstamped.Set(Param, sig)
+	if !Verify(secret, unstamped, now, 0) {
+		t.Error("signature without issue time is rejected without max age")
+	}
+	if Verify(secret, unstamped, now, time.Hour) {
+		t.Error("signature without issue time is accepted with max age")
+	}
+	unstamped.Set(TimeParam, ts)
+	if Verify(secret, unstamped, now, 0) {
+		t.Error("added issue time is accepted")
+	}
+
+	other, _ := NewSecret()
+	if Verify(other, signed, now, time.Hour) {
+		t.Error("signature of other secret is accepted")
+	}
+	if Verify("not hex", signed, now, time.Hour) {
+		t.Error("signature is accepted with broken secret")
+	}
+}
@@ -0,0 +1,155 @@
+package topd
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/felicson/topd/internal/config"
+	"github.com/felicson/topd/internal/log"
+)
+
+// listen opens a listener for unix socket, plain tcp or tls endpoint
+func listen(l config.Listener, logger log.Logger) (net.Listener, error) {
+
+	switch l.Network {
+	case "unix":
+		return listenUnix(l.Address, logger)
+	case "tcp":
+		ln, err := net.Listen("tcp", l.Address)
+		if err != nil {
+			return nil, fmt.Errorf("listen tcp %s: %v", l.Address, err)
+		}
+		return ln, nil
+	case "tls":
+		cert, err := tls.LoadX509KeyPair(l.CertFile, l.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("on load key pair: %v", err)
+		}
+		ln, err := net.Listen("tcp", l.Address)
+		if err != nil {
+			return nil, fmt.Errorf("listen tls %s: %v", l.Address, err)
+		}
+		return tls.NewListener(ln, &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}), nil
+	}
+	return nil, fmt.Errorf("unknown network %q", l.Network)
+}
+
+func listenUnix(socket string, logger log.Logger) (net.Listener, error) {
+
+	if _, err := os.Stat(socket); err == nil {
+		logger.Info("Trying to remove exist socket file")
+		if err := os.Remove(socket); err != nil {
+			return nil, fmt.Errorf("on remove socket file: %v", err)
+		}
+	}
+
+	addr, err := net.ResolveUnixAddr("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+
+	ln, err := net.ListenUnix("unix", addr)
+	if err != nil {
+		return nil, fmt.Errorf("create socket: %v", err)
+	}
+
+	if err = os.Chmod(socket, 0777); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("chmod socket: %v", err)
+	}
+	return ln, nil
+}
+
+// listenAll opens every listener, closing already opened ones on failure
+func listenAll(listeners []config.Listener, logger log.Logger) ([]net.Listener, error) {
+
+	result := make([]net.Listener, 0, len(listeners))
+	for _, l := range listeners {
+		ln, err := listen(l, logger)
+		if err != nil {
+			closeAll(result)
+			return nil, err
+		}
+		result = append(result, ln)
+	}
+	return result, nil
+}
+
+func closeAll(listeners []net.Listener) {
+	for _, ln := range listeners {
+		_ = ln.Close()
+	}
+}
+
+// endpoint is a handler served on its own set of listeners
+type endpoint struct {
+	handler   http.Handler
+	listeners []config.Listener
+	shutdown  func() // called on shutdown to finish long living requests
+}
+
+// serve runs every endpoint until done is closed or any server fails,
+// then gracefully shuts all of them down
+func serve(ctx context.Context, endpoints []endpoint, logger log.Logger, done <-chan struct{}) error {
+
+	var (
+		servers   = make([]*http.Server, len(endpoints))
+		listeners = make([][]net.Listener, len(endpoints))
+		total     int
+	)
+	defer func() {
+		for _, lns := range listeners {
+			closeAll(lns)
+		}
+	}()
+
+	for i, e := range endpoints {
+		lns, err := listenAll(e.listeners, logger)
+		if err != nil {
+			return err
+		}
+		listeners[i] = lns
+		servers[i] = &http.Server{Handler: e.handler}
+		if e.shutdown != nil {
+			servers[i].RegisterOnShutdown(e.shutdown)
+		}
+		total += len(lns)
+	}
+
+	errChannel := make(chan error, total)
+
+	for i, server := range servers {
+		for _, ln := range listeners[i] {
+			logger.Infof("listening on %s %s", ln.Addr().Network(), ln.Addr())
+			go func(server *http.Server, ln net.Listener) {
+				if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
+					errChannel <- fmt.Errorf("serve %s: %v", ln.Addr(), err)
+				}
+			}(server, ln)
+		}
+	}
+
+	var serveErr error
+	select {
+	case serveErr = <-errChannel:
+	case <-done:
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil && serveErr == nil {
+			serveErr = fmt.Errorf("shutdown server: %v", err)
+		}
+	}
+	return serveErr
+}
@@ -0,0 +1,193 @@
+package topd
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/felicson/topd/internal/config"
+)
+
+// writeCert saves self-signed certificate of 127.0.0.1 and its key to dir
+func writeCert(t *testing.T, dir string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "topd test"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &tpl, &tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// freeAddress returns loopback tcp address nobody listens on
+func freeAddress(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func TestListen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "topd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	logger := zap.NewNop().Sugar()
+	certFile, keyFile := writeCert(t, dir)
+
+	socket := filepath.Join(dir, "topd.sock")
+	// stale socket file left by a killed process
+	if err := ioutil.WriteFile(socket, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, l := range []config.Listener{
+		{Network: "unix", Address: socket},
+		{Network: "tcp", Address: "127.0.0.1:0"},
+		{Network: "tls", Address: "127.0.0.1:0", CertFile: certFile, KeyFile: keyFile},
+	} {
+		ln, err := listen(l, logger)
+		if err != nil {
+			t.Fatalf("%s: %v", l.Network, err)
+		}
+		if ln.Addr().Network() != map[string]string{"unix": "unix", "tcp": "tcp", "tls": "tcp"}[l.Network] {
+			t.Errorf("%s: unexpected address %s", l.Network, ln.Addr())
+		}
+		ln.Close()
+	}
+
+	for _, l := range []config.Listener{
+		{Network: "tls", Address: "127.0.0.1:0", CertFile: filepath.Join(dir, "missing.pem"), KeyFile: keyFile},
+		{Network: "udp", Address: "127.0.0.1:0"},
+	} {
+		if ln, err := listen(l, logger); err == nil {
+			ln.Close()
+			t.Errorf("%s %s: expected error", l.Network, l.CertFile)
+		}
+	}
+}
+
+func TestServe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "topd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeCert(t, dir)
+
+	socket := filepath.Join(dir, "topd.sock")
+	tcpAddr, tlsAddr, adminAddr := freeAddress(t), freeAddress(t), freeAddress(t)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	shutdown := make(chan struct{})
+
+	endpoints := []endpoint{
+		{handler: ok, listeners: []config.Listener{
+			{Network: "unix", Address: socket},
+			{Network: "tcp", Address: tcpAddr},
+			{Network: "tls", Address: tlsAddr, CertFile: certFile, KeyFile: keyFile},
+		}},
+		{handler: ok, listeners: []config.Listener{{Network: "tcp", Address: adminAddr}}, shutdown: func() { close(shutdown) }},
+	}
+	done := make(chan struct{})
+	result := make(chan error, 1)
+	go func() {
+		result <- serve(context.Background(), endpoints, zap.NewNop().Sugar(), done)
+	}()
+
+	unixClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	tlsClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	requests := []struct {
+		client *http.Client
+		url    string
+	}{
+		{unixClient, "http://topd/"},
+		{http.DefaultClient, "http://" + tcpAddr + "/"},
+		{tlsClient, "https://" + tlsAddr + "/"},
+		{http.DefaultClient, "http://" + adminAddr + "/"},
+	}
+	for _, r := range requests {
+		var resp *http.Response
+		// listeners are opened asynchronously
+		for i := 0; i < 50; i++ {
+			if resp, err = r.client.Get(r.url); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", r.url, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			t.Errorf("%s: unexpected status %d", r.url, resp.StatusCode)
+		}
+	}
+
+	close(done)
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not return after done")
+	}
+	select {
+	case <-shutdown:
+	case <-time.After(time.Second):
+		t.Error("shutdown hook is not called")
+	}
+
+	for _, r := range requests {
+		r.client.CloseIdleConnections()
+		if resp, err := r.client.Get(r.url); err == nil {
+			resp.Body.Close()
+			t.Errorf("%s: listener is still open", r.url)
+		}
+	}
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Errorf("socket file is left: %v", err)
+	}
+}
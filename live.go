@@ -0,0 +1,98 @@
+package topd
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const liveHeartbeat = 15 * time.Second
+
+// liveMode is the signed mode of public live stream urls, counter urls never carry it,
+// so their signatures published on pages do not open the stream
+const liveMode = "live"
+
+type liveHit struct {
+	Page     string    `json:"page"`
+	Referrer string    `json:"referrer"`
+	Country  string    `json:"country"`
+	Bot      bool      `json:"bot"`
+	Date     time.Time `json:"date"`
+}
+
+// liveAccess allows the public live stream only to urls signed with the site secret for live mode,
+// sites without secret have no public stream
+func (web *Web) liveAccess(next http.HandlerFunc) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		siteID, _ := strconv.Atoi(req.FormValue("id"))
+		site, ok := web.siteMap.Get(siteID)
+		if !ok {
+			NotFound(w, req)
+			return
+		}
+		query := req.URL.Query()
+		if query.Get("mode") != liveMode || !site.SignatureRequired() || !web.verifySignature(req, site, query) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		next(w, req)
+	}
+}
+
+// LiveServer streams accepted hits of the site as server-sent events: /live/?id=1,
+// it is served by the admin listener behind its auth and by the public one behind liveAccess
+func (web *Web) LiveServer(w http.ResponseWriter, req *http.Request) {
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	siteID, _ := strconv.Atoi(req.FormValue("id"))
+	if _, ok := web.siteMap.Get(siteID); !ok {
+		NotFound(w, req)
+		return
+	}
+
+	sub := web.live.Subscribe(siteID)
+	defer web.live.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(liveHeartbeat)
+	defer heartbeat.Stop()
+
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := w.Write([]byte(": ping\n\n")); err != nil {
+				return
+			}
+		case hit, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if _, err := w.Write([]byte("event: hit\ndata: ")); err != nil {
+				return
+			}
+			// Encode terminates data with a newline, second one ends the event
+			if err := enc.Encode(liveHit(hit)); err != nil {
+				return
+			}
+			if _, err := w.Write([]byte("\n")); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
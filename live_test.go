@@ -0,0 +1,102 @@
+package topd
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/felicson/topd/internal/sign"
+	"github.com/felicson/topd/storage"
+)
+
+func TestLiveServer(t *testing.T) {
+	web := newTestWeb(t)
+	srv := httptest.NewServer(http.HandlerFunc(web.LiveServer))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/live/?id=100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown site: unexpected status %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(srv.URL + "/live/?id=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/top/?id=2&mode=beacon&p=https://example.com/live", nil)
+	req.AddCookie(&http.Cookie{Name: "sess", Value: "live"})
+	web.ErrHandler(web.TopServer)(rec, req)
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		var hit liveHit
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &hit); err != nil {
+			t.Fatal(err)
+		}
+		if hit.Page != "https://example.com/live" {
+			t.Errorf("unexpected hit %+v", hit)
+		}
+		return
+	}
+	t.Fatalf("stream ended without hit: %v", scanner.Err())
+}
+
+func TestLiveAccess(t *testing.T) {
+	web := newTestWeb(t)
+	handler := web.liveAccess(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	signed := func(site *storage.Site, mode string) string {
+		query := url.Values{"id": {strconv.Itoa(site.ID)}, "mode": {mode}}
+		sign.Stamp(query, time.Now())
+		sig, err := site.Sign(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		query.Set(sign.Param, sig)
+		return "/live/?" + query.Encode()
+	}
+
+	if _, err := web.siteMap.RotateSecret(1); err != nil {
+		t.Fatal(err)
+	}
+	signedSite, _ := web.siteMap.Get(1)
+
+	for _, c := range []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{"unknown site", "/live/?id=100&mode=live", http.StatusNotFound},
+		{"site without secret", "/live/?id=2&mode=live", http.StatusForbidden},
+		{"unsigned", "/live/?id=1&mode=live", http.StatusForbidden},
+		{"counter signature", signed(signedSite, "pixel"), http.StatusForbidden},
+		{"live signature", signed(signedSite, liveMode), http.StatusOK},
+	} {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, c.path, nil))
+		if rec.Code != c.status {
+			t.Errorf("%s: expected %d, got %d", c.name, c.status, rec.Code)
+		}
+	}
+}
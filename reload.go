@@ -0,0 +1,223 @@
+package topd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/felicson/topd/image"
+	"github.com/felicson/topd/internal/bot"
+	"github.com/felicson/topd/internal/config"
+	"github.com/felicson/topd/internal/metrics"
+	"github.com/felicson/topd/internal/referrer"
+)
+
+// LogLevel changes logger verbosity at runtime
+type LogLevel interface {
+	Check(level string) error // validates level name without applying it
+	Set(level string) error
+}
+
+var errNoImages = errors.New("no counter images loaded")
+
+// liveState is configuration, bots list, referrer blocklist and counter images replaced on reload.
+// It is never changed after publishing, reload publishes a new one as a whole,
+// so a request holding a state never sees parts of different reloads.
+type liveState struct {
+	config    config.Config
+	bots      *bot.Checker
+	referrers *referrer.Blocklist // nil when referrer spam is not checked
+	images    image.ImageList
+}
+
+// defaultImage returns counter shown for unknown sites: configured one when it is loaded,
+// the lowest loaded id otherwise
+func (s *liveState) defaultImage() (image.Image, error) {
+	if preferred := s.config.DefaultCounter; preferred > 0 {
+		if img, err := s.images.GetImage(uint(preferred)); err == nil {
+			return img, nil
+		}
+	}
+	id, ok := s.images.Lowest()
+	if !ok {
+		return image.Image{}, errNoImages
+	}
+	return s.images.GetImage(id)
+}
+
+// liveConfig holds the current liveState
+type liveConfig struct {
+	state atomic.Value // *liveState
+}
+
+func newLiveConfig(state liveState) *liveConfig {
+	lc := &liveConfig{}
+	lc.state.Store(&state)
+	return lc
+}
+
+// Load returns the current state
+func (lc *liveConfig) Load() *liveState {
+	return lc.state.Load().(*liveState)
+}
+
+// Get returns the current configuration
+func (lc *liveConfig) Get() config.Config {
+	return lc.Load().config
+}
+
+// Set publishes the current state with the configuration replaced
+func (lc *liveConfig) Set(conf config.Config) {
+	lc.update(func(state *liveState) {
+		state.config = conf
+	})
+}
+
+// update publishes copy of the current state changed by fn, callers serialize updates
+func (lc *liveConfig) update(fn func(state *liveState)) {
+	state := *lc.Load()
+	fn(&state)
+	lc.state.Store(&state)
+}
+
+// reloader applies changed configuration, bots list and counter images without restart.
+// Listeners, database and other fields used only on start are left as is.
+type reloader struct {
+	lock  sync.Mutex
+	load  func() (config.Config, error)
+	level LogLevel
+	web   *Web
+}
+
+// Reload loads everything first and publishes it in one state only when all parts are loaded
+func (r *reloader) Reload() error {
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	err := r.reload()
+	if err != nil {
+		metrics.Reloads.WithLabelValues("fail").Inc()
+		return err
+	}
+	metrics.Reloads.WithLabelValues("ok").Inc()
+	return nil
+}
+
+func (r *reloader) reload() error {
+
+	conf, err := r.load()
+	if err != nil {
+		return fmt.Errorf("on load config: %v", err)
+	}
+	if err := r.level.Check(conf.LogLevel); err != nil {
+		return fmt.Errorf("on parse log level: %v", err)
+	}
+	bots, err := bot.NewCheckerFromFile(conf.BotsList)
+	if err != nil {
+		return fmt.Errorf("on build bot checker: %v", err)
+	}
+	images, err := image.NewImages(conf.ImagesPath)
+	if err != nil {
+		return fmt.Errorf("on build images: %v", err)
+	}
+	state := *r.web.config.Load()
+	if state.referrers != nil {
+		if state.referrers, err = state.referrers.Load(); err != nil {
+			return fmt.Errorf("on load referrer blocklist: %v", err)
+		}
+	}
+
+	current := state.config
+	if conf.ReferrerList != current.ReferrerList {
+		r.web.logger.Errorf("referrer_blocklist %q is applied on restart only, %q is kept", conf.ReferrerList, current.ReferrerList)
+	}
+	current.LogLevel = conf.LogLevel
+	current.BotsList = conf.BotsList
+	current.ImagesPath = conf.ImagesPath
+	current.DefaultCounter = conf.DefaultCounter
+	current.Cookieless = conf.Cookieless
+	current.ReferrerSpam = conf.ReferrerSpam
+	state.config = current
+	state.bots = &bots
+	state.images = images
+
+	// everything is loaded, level is checked above so it does not fail after the state is published
+	if err := r.level.Set(conf.LogLevel); err != nil {
+		return fmt.Errorf("on set log level: %v", err)
+	}
+	r.web.config.update(func(live *liveState) {
+		*live = state
+	})
+
+	r.web.logger.Info("configuration reloaded")
+	return nil
+}
+
+// reloadReferrers publishes referrer blocklist reloaded from its file when the file is changed
+func (r *reloader) reloadReferrers() error {
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	state := r.web.config.Load()
+	if state.referrers == nil {
+		return nil
+	}
+	changed, err := state.referrers.Changed()
+	if err != nil || !changed {
+		return err
+	}
+	referrers, err := state.referrers.Load()
+	if err != nil {
+		return err
+	}
+	r.web.config.update(func(live *liveState) {
+		live.referrers = referrers
+	})
+	r.web.logger.Infof("referrer blocklist %s reloaded", state.config.ReferrerList)
+	return nil
+}
+
+// watchReferrers checks referrer blocklist file every interval until ctx is done
+func (r *reloader) watchReferrers(ctx context.Context, interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.reloadReferrers(); err != nil {
+				r.web.logger.Errorf("on reload referrer blocklist: %v", err)
+			}
+		}
+	}
+}
+
+// watch reloads on SIGUSR1 until ctx is done
+func (r *reloader) watch(ctx context.Context) {
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGUSR1)
+	defer signal.Stop(sigChan)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sigChan:
+			if err := r.Reload(); err != nil {
+				r.web.logger.Error(err)
+			}
+		}
+	}
+}
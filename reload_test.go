@@ -0,0 +1,148 @@
+package topd
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/felicson/topd/internal/config"
+	"github.com/felicson/topd/internal/referrer"
+)
+
+type levelStub struct {
+	level string
+}
+
+func (l *levelStub) Check(level string) error {
+	if level == "bogus" {
+		return errors.New("unknown level")
+	}
+	return nil
+}
+
+func (l *levelStub) Set(level string) error {
+	l.level = level
+	return nil
+}
+
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "topd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bots := filepath.Join(dir, "bots.txt")
+	if err := ioutil.WriteFile(bots, []byte("Reloaded/1.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	spam := filepath.Join(dir, "spam.txt")
+	if err := ioutil.WriteFile(spam, []byte("spam.example\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	web := newTestWeb(t)
+	core, logs := observer.New(zap.InfoLevel)
+	web.logger = zap.New(core).Sugar()
+	referrers, err := referrer.NewBlocklistFromFile(spam)
+	if err != nil {
+		t.Fatal(err)
+	}
+	web.config.update(func(state *liveState) {
+		state.referrers = referrers
+		state.config = config.Config{ReferrerList: spam}
+	})
+	if err := ioutil.WriteFile(spam, []byte("reloaded.example\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	conf := config.Config{BotsList: bots, ImagesPath: "counters/m", LogLevel: "debug", Cookieless: true, Host: "ignored", ReferrerList: spam}
+	level := &levelStub{}
+	r := reloader{
+		load:  func() (config.Config, error) { return conf, nil },
+		level: level,
+		web:   web,
+	}
+	site, _ := web.siteMap.Get(1)
+	req := httptest.NewRequest(http.MethodGet, "/top/?id=1", nil)
+
+	initial := web.config.Load()
+	if initial.bots.BadUserAgent("Reloaded/1.0") || web.cookieless(req, site) {
+		t.Fatal("unexpected initial state")
+	}
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	state := web.config.Load()
+	if !state.bots.BadUserAgent("Reloaded/1.0") || !web.cookieless(req, site) || level.level != "debug" || !state.referrers.Blocked("https://reloaded.example/") {
+		t.Error("configuration is not applied")
+	}
+	// state taken before reload keeps all previous parts
+	if initial.bots.BadUserAgent("Reloaded/1.0") || initial.config.Cookieless || initial.referrers.Blocked("https://reloaded.example/") {
+		t.Error("reload changed published state")
+	}
+	if logs.FilterMessageSnippet("referrer_blocklist").Len() != 0 {
+		t.Error("unchanged referrer blocklist path is reported")
+	}
+	if state.config.Host != "" {
+		t.Error("not reloadable field is changed")
+	}
+
+	// nothing is published when any part fails to load
+	if err := ioutil.WriteFile(bots, []byte("Other/1.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(spam, []byte("other.example\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for name, failing := range map[string]config.Config{
+		"missing bots list": {BotsList: filepath.Join(dir, "missing.txt"), ImagesPath: "counters/m", ReferrerList: spam},
+		"missing images":    {BotsList: bots, ImagesPath: filepath.Join(dir, "missing"), ReferrerList: spam},
+		"unknown log level": {BotsList: bots, ImagesPath: "counters/m", LogLevel: "bogus", ReferrerList: spam},
+	} {
+		conf = failing
+		if err := r.Reload(); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+		if web.config.Load() != state || level.level != "debug" {
+			t.Errorf("%s: failed reload published part of configuration", name)
+		}
+	}
+	if referrers.Blocked("https://other.example/") || state.bots.BadUserAgent("Other/1.0") {
+		t.Error("failed reload changed loaded parts in place")
+	}
+
+	conf = config.Config{BotsList: bots, ImagesPath: "counters/m", LogLevel: "info", ReferrerList: filepath.Join(dir, "moved.txt")}
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if logs.FilterMessageSnippet("referrer_blocklist").Len() != 1 || !web.config.Load().referrers.Blocked("https://other.example/") {
+		t.Error("changed referrer blocklist path is not reported")
+	}
+
+	// blocklist file change publishes only the reloaded blocklist
+	state = web.config.Load()
+	if err := ioutil.WriteFile(spam, []byte("watched.example\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(spam, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.reloadReferrers(); err != nil {
+		t.Fatal(err)
+	}
+	watched := web.config.Load()
+	if !watched.referrers.Blocked("https://watched.example/") || watched.bots != state.bots || watched.config.LogLevel != "info" {
+		t.Error("changed blocklist is not published alone")
+	}
+	if err := r.reloadReferrers(); err != nil || web.config.Load() != watched {
+		t.Errorf("unchanged blocklist is published again: %v", err)
+	}
+}
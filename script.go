@@ -0,0 +1,86 @@
+package topd
+
+import (
+	"net/http"
+)
+
+const scriptVersion = "6"
+
+// trackerScript collects page properties and inserts the counter image.
+// Embed code: <script async src="https://top.example.com/top.js" data-id="1"></script>,
+// optional data-mode="pixel" or data-mode="beacon" hides the counter,
+// data-format="svg" selects svg counter, data-sig and data-ts carry signature and its issue time
+// for sites requiring signed urls, signed parameters are sent with custom events too.
+// Custom events are sent with window.topd.event("purchase", 9.99).
+const trackerScript = `/* topd tracker v` + scriptVersion + ` */
+(function (w, d, n) {
+	var s = d.currentScript;
+	if (!s) {
+		var l = d.getElementsByTagName("script");
+		s = l[l.length - 1];
+	}
+	var id = s.getAttribute("data-id");
+	if (!id) {
+		return;
+	}
+	var a = d.createElement("a");
+	a.href = s.src;
+	var base = a.protocol + "//" + a.host;
+	var signed = [];
+	var attrs = ["mode", "format", "ts", "sig"];
+	for (var i = 0; i < attrs.length; i++) {
+		var v = s.getAttribute("data-" + attrs[i]);
+		if (v) {
+			signed.push(attrs[i] + "=" + encodeURIComponent(v));
+		}
+	}
+	w.topd = w.topd || {};
+	w.topd.event = function (name, value) {
+		var e = [
+			"id=" + encodeURIComponent(id),
+			"name=" + encodeURIComponent(name),
+			"p=" + encodeURIComponent(w.location.href)
+		].concat(signed);
+		if (value !== undefined) {
+			e.push("value=" + encodeURIComponent(value));
+		}
+		var url = base + "/event/?" + e.join("&");
+		if (n.sendBeacon) {
+			n.sendBeacon(url);
+		} else {
+			(new Image()).src = url;
+		}
+	};
+	var q = [
+		"id=" + encodeURIComponent(id),
+		"p=" + encodeURIComponent(w.location.href),
+		"ref=" + encodeURIComponent(d.referrer),
+		"scr=" + w.screen.width + "x" + w.screen.height,
+		"lang=" + encodeURIComponent(n.language || n.userLanguage || ""),
+		"t=" + encodeURIComponent(d.title.substring(0, 255))
+	].concat(signed);
+	var img = d.createElement("img");
+	img.alt = "";
+	img.src = base + "/top/?" + q.join("&");
+	s.parentNode.insertBefore(img, s.nextSibling);
+})(window, document, navigator);
+`
+
+const scriptETag = `"topd-js-` + scriptVersion + `"`
+
+// ScriptServer serves the javascript tracker
+func (web *Web) ScriptServer(w http.ResponseWriter, req *http.Request) {
+
+	w.Header().Set("ETag", scriptETag)
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+
+	if req.Header.Get("If-None-Match") == scriptETag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+	if _, err := w.Write([]byte(trackerScript)); err != nil {
+		web.logger.Error(err)
+	}
+}
@@ -0,0 +1,56 @@
+package topd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestScriptServer(t *testing.T) {
+	web := newTestWeb(t)
+
+	rec := httptest.NewRecorder()
+	web.ScriptServer(rec, httptest.NewRequest(http.MethodGet, "/top.js", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d", rec.Code)
+	}
+	for header, value := range map[string]string{
+		"Content-Type":  "application/javascript; charset=utf-8",
+		"Cache-Control": "public, max-age=86400",
+		"ETag":          `"topd-js-` + scriptVersion + `"`,
+	} {
+		if got := rec.Header().Get(header); got != value {
+			t.Errorf("%s: expected %q, got %q", header, value, got)
+		}
+	}
+
+	body := rec.Body.String()
+	for _, part := range []string{
+		"topd tracker v" + scriptVersion,
+		// the embed code needs only data-id
+		`s.getAttribute("data-id")`,
+		// page properties are sent to the collector with the counter request
+		`base + "/top/?"`,
+		`"p=" + encodeURIComponent(w.location.href)`,
+		`"ref=" + encodeURIComponent(d.referrer)`,
+		`"scr=" + w.screen.width`,
+		`"lang=" + encodeURIComponent(`,
+		`"t=" + encodeURIComponent(d.title`,
+		`d.createElement("img")`,
+		"insertBefore(img",
+		`base + "/event/?"`,
+	} {
+		if !strings.Contains(body, part) {
+			t.Errorf("script does not contain %s", part)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/top.js", nil)
+	req.Header.Set("If-None-Match", `"topd-js-`+scriptVersion+`"`)
+	web.ScriptServer(rec, req)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("expected empty 304, got %d with %d bytes", rec.Code, rec.Body.Len())
+	}
+}
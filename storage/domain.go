@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+)
+
+// Domain is a host the site counter is allowed to be shown on, subdomains included
+type Domain struct {
+	SiteID int
+	Name   string
+}
+
+// ErrWrongDomain is returned for domain which is not a valid host name
+var ErrWrongDomain = errors.New("wrong domain")
+
+// NormalizeDomain lower cases the domain and strips leading wildcard and trailing dot
+func NormalizeDomain(domain string) (string, error) {
+	domain = strings.TrimSuffix(strings.TrimLeft(strings.ToLower(strings.TrimSpace(domain)), "*."), ".")
+	if domain == "" || len(domain) > 253 {
+		return "", ErrWrongDomain
+	}
+	for _, r := range domain {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' && r != '.' {
+			return "", ErrWrongDomain
+		}
+	}
+	return domain, nil
+}
+
+// AllowedHost reports whether the counter may be shown on the host,
+// any host is allowed while the site has no domains
+func (s *Site) AllowedHost(host string) bool {
+
+	s.l.RLock()
+	defer s.l.RUnlock()
+
+	if len(s.domains) == 0 {
+		return true
+	}
+	for _, d := range s.domains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Site) setDomains(domains []string) {
+	s.l.Lock()
+	s.domains = domains
+	s.l.Unlock()
+}
+
+// SetDomains saves allowed domains of the site replacing the previous ones
+func (sm *SiteAggregate) SetDomains(siteID int, domains []string) error {
+
+	site, ok := sm.Get(siteID)
+	if !ok {
+		return ErrUnknownSite
+	}
+	normalized := make([]string, 0, len(domains))
+	for _, d := range domains {
+		n, err := NormalizeDomain(d)
+		if err != nil {
+			return err
+		}
+		normalized = append(normalized, n)
+	}
+	if err := sm.storage.SetDomains(siteID, normalized); err != nil {
+		return err
+	}
+	site.setDomains(normalized)
+	return nil
+}
@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"net/url"
+	"path"
+	"time"
+)
+
+const maxEventName = 64
+
+// Event is a named user action with optional numeric value
+type Event struct {
+	SiteID int
+	Name   string
+	Value  *float64
+	Page   string
+	Sess   string
+	Date   time.Time
+}
+
+type EventCollection []Event
+
+// Goal counts conversions either by event name or by page path pattern
+type Goal struct {
+	ID     int
+	SiteID int
+	Name   string
+	Event  string
+	Page   string // path.Match pattern, e.g. /order/*/done
+}
+
+func (g Goal) matchEvent(name string) bool {
+	return g.Event != "" && g.Event == name
+}
+
+func (g Goal) matchPage(page string) bool {
+	if g.Page == "" {
+		return false
+	}
+	u, err := url.Parse(page)
+	if err != nil {
+		return false
+	}
+	ok, _ := path.Match(g.Page, u.Path)
+	return ok
+}
+
+// ValidEventName checks the event name is short and contains only [a-zA-Z0-9_.-]
+func ValidEventName(name string) bool {
+	if name == "" || len(name) > maxEventName {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_' || c == '.' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
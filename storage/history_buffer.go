@@ -0,0 +1,51 @@
+package storage
+
+import "sync"
+
+// HistoryBuffer keeps rows and events collected between keeper flushes,
+// it is filled by the history collector and drained by the keeper
+type HistoryBuffer struct {
+	lock   sync.Mutex
+	rows   TopDataCollection
+	events EventCollection
+}
+
+func (b *HistoryBuffer) addRow(row TopData) {
+	b.lock.Lock()
+	b.rows = append(b.rows, row)
+	b.lock.Unlock()
+}
+
+func (b *HistoryBuffer) addEvent(event Event) {
+	b.lock.Lock()
+	b.events = append(b.events, event)
+	b.lock.Unlock()
+}
+
+// Take returns collected rows and events leaving the buffer empty
+func (b *HistoryBuffer) Take() (TopDataCollection, EventCollection) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	rows, events := b.rows, b.events
+	b.rows, b.events = nil, nil
+	return rows, events
+}
+
+// Restore puts back rows and events taken by a failed flush ahead of the ones collected since then
+func (b *HistoryBuffer) Restore(rows TopDataCollection, events EventCollection) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if len(rows) > 0 {
+		b.rows = append(rows, b.rows...)
+	}
+	if len(events) > 0 {
+		b.events = append(events, b.events...)
+	}
+}
+
+// Len returns number of collected rows
+func (b *HistoryBuffer) Len() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return len(b.rows)
+}
@@ -0,0 +1,22 @@
+package storage
+
+import "testing"
+
+func TestHistoryBufferRestore(t *testing.T) {
+	var b HistoryBuffer
+	b.addRow(TopData{Page: "first"})
+	b.addEvent(Event{Name: "first"})
+	rows, events := b.Take()
+
+	b.addRow(TopData{Page: "second"})
+	b.Restore(rows, events)
+	b.Restore(nil, nil)
+
+	rows, events = b.Take()
+	if len(rows) != 2 || rows[0].Page != "first" || rows[1].Page != "second" {
+		t.Errorf("unexpected rows %+v", rows)
+	}
+	if len(events) != 1 || events[0].Name != "first" {
+		t.Errorf("unexpected events %+v", events)
+	}
+}
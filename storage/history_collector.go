@@ -2,26 +2,31 @@ package storage
 
 import (
 	"context"
-	"net"
+	"sync/atomic"
+	"time"
 )
 
 // HistoryCollector provide instance for store user activity history
 type HistoryCollector struct {
-	active   bool
-	dataChan chan RawTopData
-	topData  *TopDataCollection
+	active    int32
+	dataChan  chan RawTopData
+	eventChan chan Event
+	buffer    *HistoryBuffer
 }
 
 // Run starts history collector
 func (hc *HistoryCollector) Run(ctx context.Context) {
-	hc.active = true
+	atomic.StoreInt32(&hc.active, 1)
 	go func() {
+		defer atomic.StoreInt32(&hc.active, 0)
 
 	LOOP:
 		for {
 			select {
 			case item := <-hc.dataChan:
-				*hc.topData = append(*hc.topData, newHistoryRow(&item))
+				hc.buffer.addRow(newHistoryRow(&item))
+			case event := <-hc.eventChan:
+				hc.buffer.addEvent(event)
 			case <-ctx.Done():
 				break LOOP
 			}
@@ -30,15 +35,68 @@ func (hc *HistoryCollector) Run(ctx context.Context) {
 	}()
 }
 
-func (hc *HistoryCollector) WriteHistory(page, referrer, xGeo, session, userAgent string, ip net.IP, siteID int) error {
-	if !hc.active {
+// Len returns number of hits waiting in the queue
+func (hc *HistoryCollector) Len() int {
+	return len(hc.dataChan)
+}
+
+// Cap returns the queue capacity
+func (hc *HistoryCollector) Cap() int {
+	return cap(hc.dataChan)
+}
+
+// EventsLen returns number of events waiting in the queue
+func (hc *HistoryCollector) EventsLen() int {
+	return len(hc.eventChan)
+}
+
+// EventsCap returns the events queue capacity
+func (hc *HistoryCollector) EventsCap() int {
+	return cap(hc.eventChan)
+}
+
+// Pending returns number of collected rows waiting for the flush
+func (hc *HistoryCollector) Pending() int {
+	return hc.buffer.Len()
+}
+
+// Ready reports whether collector accepts hits and events without blocking
+func (hc *HistoryCollector) Ready() error {
+	if atomic.LoadInt32(&hc.active) == 0 {
+		return ErrHistoryCollectorStopped
+	}
+	if hc.Len() >= hc.Cap() || hc.EventsLen() >= hc.EventsCap() {
+		return ErrHistoryCollectorSaturated
+	}
+	return nil
+}
+
+func (hc *HistoryCollector) WriteHistory(data RawTopData) error {
+	if atomic.LoadInt32(&hc.active) == 0 {
+		return ErrHistoryCollectorStopped
+	}
+
+	hc.dataChan <- data
+	return nil
+}
+
+// WriteEvent puts custom event to the events collection
+func (hc *HistoryCollector) WriteEvent(event Event) error {
+	if atomic.LoadInt32(&hc.active) == 0 {
 		return ErrHistoryCollectorStopped
 	}
+	if event.Date.IsZero() {
+		event.Date = time.Now()
+	}
 
-	hc.dataChan <- RawTopData{page, referrer, xGeo, session, userAgent, ip, siteID}
+	hc.eventChan <- event
 	return nil
 }
 
-func NewHistoryCollector(dst *TopDataCollection, cap int) HistoryCollector {
-	return HistoryCollector{dataChan: make(chan RawTopData, cap), topData: dst}
+func NewHistoryCollector(buffer *HistoryBuffer, cap int) HistoryCollector {
+	return HistoryCollector{
+		dataChan:  make(chan RawTopData, cap),
+		eventChan: make(chan Event, cap),
+		buffer:    buffer,
+	}
 }
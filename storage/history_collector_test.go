@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+func TestHistoryCollectorReady(t *testing.T) {
+	hc := NewHistoryCollector(&HistoryBuffer{}, 1)
+	if err := hc.Ready(); err != ErrHistoryCollectorStopped {
+		t.Errorf("inactive collector: unexpected %v", err)
+	}
+
+	// active without the consuming goroutine, so queues stay filled
+	atomic.StoreInt32(&hc.active, 1)
+	if err := hc.Ready(); err != nil {
+		t.Errorf("empty queues: unexpected %v", err)
+	}
+	if err := hc.WriteHistory(RawTopData{SiteID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := hc.Ready(); err != ErrHistoryCollectorSaturated {
+		t.Errorf("full hits queue: unexpected %v", err)
+	}
+	<-hc.dataChan
+
+	if err := hc.WriteEvent(Event{SiteID: 1, Name: "signup"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := hc.Ready(); err != ErrHistoryCollectorSaturated {
+		t.Errorf("full events queue: unexpected %v", err)
+	}
+}
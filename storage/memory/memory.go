@@ -2,15 +2,29 @@ package memory
 
 import (
 	"fmt"
+	"sort"
+	"sync"
 
 	"github.com/felicson/topd/internal/config"
 	"github.com/felicson/topd/storage"
 )
 
-type Memory struct{}
+type Memory struct {
+	lock    *sync.Mutex
+	domains map[int][]string
+	goals   map[int]storage.Goal // by goal id
+	resets  map[string]string
+	secrets map[int]string
+}
 
 func New(_ config.Config) (Memory, error) {
-	return Memory{}, nil
+	return Memory{
+		lock:    &sync.Mutex{},
+		domains: make(map[int][]string),
+		goals:   make(map[int]storage.Goal),
+		resets:  make(map[string]string),
+		secrets: make(map[int]string),
+	}, nil
 }
 
 func (m Memory) SaveData(tmpTopDataArray []storage.TopData) error {
@@ -20,19 +34,98 @@ func (m Memory) SaveData(tmpTopDataArray []storage.TopData) error {
 	return nil
 }
 
+func (m Memory) SaveEvents(events []storage.Event) error {
+	for _, e := range events {
+		fmt.Println(e)
+	}
+	return nil
+}
+
+func (m Memory) Goals() ([]storage.Goal, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	goals := make([]storage.Goal, 0, len(m.goals))
+	for _, g := range m.goals {
+		goals = append(goals, g)
+	}
+	sort.Slice(goals, func(i, j int) bool { return goals[i].ID < goals[j].ID })
+	return goals, nil
+}
+
+// SetGoal adds or replaces goal with the same id
+func (m Memory) SetGoal(goal storage.Goal) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.goals[goal.ID] = goal
+	return nil
+}
+
+func (m Memory) Domains() ([]storage.Domain, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var domains []storage.Domain
+	for id, names := range m.domains {
+		for _, name := range names {
+			domains = append(domains, storage.Domain{SiteID: id, Name: name})
+		}
+	}
+	return domains, nil
+}
+
+func (m Memory) SetDomains(siteID int, domains []string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.domains[siteID] = append([]string(nil), domains...)
+	return nil
+}
+
+func (m Memory) SetSecret(siteID int, secret string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.secrets[siteID] = secret
+	return nil
+}
+
+func (m Memory) ResetDays() (map[string]string, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	days := make(map[string]string, len(m.resets))
+	for zone, day := range m.resets {
+		days[zone] = day
+	}
+	return days, nil
+}
+
+func (m Memory) SetResetDay(zone, day string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.resets[zone] = day
+	return nil
+}
+
 func (m Memory) Populate(lastID int) ([]storage.Site, error) {
-	// returns data only for the fist call
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	// returns the same two sites with saved secrets
 	if lastID == 0 {
 		return []storage.Site{
-			{Hosts: 0, Hits: 0, ID: 1, CounterID: 1, Digits: true},
-			{Hosts: 0, Hits: 0, ID: 2, CounterID: 2, Digits: true},
+			{Hosts: 0, Hits: 0, ID: 1, CounterID: 1, Digits: true, Secret: m.secrets[1]},
+			{Hosts: 0, Hits: 0, ID: 2, CounterID: 2, Digits: true, Secret: m.secrets[2]},
 		}, nil
 
 	}
 	return []storage.Site{}, nil
 }
 
-func (m Memory) UpdateSites(_ []storage.Site) error {
+func (m Memory) UpdateSites(_ []storage.SiteStat) error {
+	return nil
+}
+
+func (m Memory) Ping() error {
 	return nil
 }
 
@@ -0,0 +1,4 @@
+ALTER TABLE `top_data`
+  ADD COLUMN `screen` varchar(11) NOT NULL DEFAULT '',
+  ADD COLUMN `lang` varchar(35) NOT NULL DEFAULT '',
+  ADD COLUMN `title` varchar(255) NOT NULL DEFAULT ''
\ No newline at end of file
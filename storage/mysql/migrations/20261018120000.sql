@@ -0,0 +1,22 @@
+CREATE TABLE `top_events` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `site_id` int(10) unsigned NOT NULL,
+  `sess_id` char(16) NOT NULL,
+  `name` varchar(64) NOT NULL,
+  `value` double DEFAULT NULL,
+  `page` varchar(255) NOT NULL,
+  `date` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `day` int(10) unsigned NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `site_id_day` (`site_id`,`day`,`name`)
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8;
+
+CREATE TABLE `top_goals` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `site_id` int(11) NOT NULL,
+  `name` varchar(100) NOT NULL,
+  `event` varchar(64) NOT NULL DEFAULT '',
+  `page_pattern` varchar(255) NOT NULL DEFAULT '',
+  PRIMARY KEY (`id`),
+  KEY `site_id` (`site_id`)
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE `top_sites`
+  ADD COLUMN `cookieless` tinyint(1) NOT NULL DEFAULT 0
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE `top_sites`
+  ADD COLUMN `opt_out_policy` tinyint(1) NOT NULL DEFAULT 0
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE `top_data`
+  ADD COLUMN `flags` tinyint(3) unsigned NOT NULL DEFAULT 0
\ No newline at end of file
@@ -0,0 +1,8 @@
+CREATE TABLE `top_site_domains` (
+  `site_id` int(11) NOT NULL,
+  `domain` varchar(253) NOT NULL,
+  PRIMARY KEY (`site_id`,`domain`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+ALTER TABLE `top_sites`
+  ADD COLUMN `strict_referer` tinyint(1) NOT NULL DEFAULT 0
\ No newline at end of file
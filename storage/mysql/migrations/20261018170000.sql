@@ -0,0 +1,2 @@
+ALTER TABLE `top_sites`
+  ADD COLUMN `sign_secret` varchar(64) NOT NULL DEFAULT ''
\ No newline at end of file
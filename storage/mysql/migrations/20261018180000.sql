@@ -0,0 +1,2 @@
+ALTER TABLE `top_sites`
+  ADD COLUMN `timezone` varchar(64) NOT NULL DEFAULT ''
\ No newline at end of file
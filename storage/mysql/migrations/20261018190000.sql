@@ -0,0 +1,5 @@
+CREATE TABLE `top_resets` (
+  `zone` varchar(64) NOT NULL,
+  `day` date NOT NULL,
+  PRIMARY KEY (`zone`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -0,0 +1,2 @@
+ALTER TABLE `top_data`
+  MODIFY COLUMN `ip` varchar(45) NOT NULL
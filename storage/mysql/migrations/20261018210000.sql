@@ -0,0 +1,2 @@
+ALTER TABLE `top_sites`
+  ADD COLUMN `sign_max_age` int unsigned NOT NULL DEFAULT 0
@@ -1,8 +1,10 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"net"
 	"time"
 
 	"github.com/felicson/topd/internal/config"
@@ -47,8 +49,8 @@ func (s Mysql) SaveData(tmpTopDataArray []storage.TopData) (err error) {
 		return nil
 	}
 
-	sqlQ := `INSERT INTO top_data (user_id, sess_id, page, refferer, date, day, ua, ip, city, country) 
-				VALUES (?,?,?,?,?,?,?,?,?,?)`
+	sqlQ := `INSERT INTO top_data (user_id, sess_id, page, refferer, date, day, ua, ip, city, country, screen, lang, title, flags) 
+				VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?)`
 
 	tx, err := s.db.Begin()
 	if err != nil {
@@ -76,9 +78,13 @@ func (s Mysql) SaveData(tmpTopDataArray []storage.TopData) (err error) {
 			row.Date.Format(createdFormat),
 			toDays(row.Date, s.location),
 			row.UA,
-			row.IP.String(),
+			ipString(row.IP),
 			row.City,
 			row.Country,
+			row.Screen,
+			row.Lang,
+			row.Title,
+			row.Flags,
 		); err != nil {
 			return fmt.Errorf("on exec tx: %v", err)
 		}
@@ -90,9 +96,158 @@ func (s Mysql) SaveData(tmpTopDataArray []storage.TopData) (err error) {
 	return
 }
 
+func (s Mysql) SaveEvents(events []storage.Event) (err error) {
+
+	if len(events) == 0 {
+		return nil
+	}
+
+	sqlQ := `INSERT INTO top_events (site_id, sess_id, name, value, page, date, day) VALUES (?,?,?,?,?,?,?)`
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("on begin tx: %v", err)
+	}
+
+	stmt, err := tx.Prepare(sqlQ)
+	if err != nil {
+		return fmt.Errorf("on stmt prepare: %v", err)
+	}
+	defer stmt.Close()
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	for _, e := range events {
+		if _, err := stmt.Exec(e.SiteID,
+			e.Sess,
+			e.Name,
+			e.Value,
+			e.Page,
+			e.Date.Format(createdFormat),
+			toDays(e.Date, s.location),
+		); err != nil {
+			return fmt.Errorf("on exec tx: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("on commit tx: %v", err)
+	}
+	return
+}
+
+func (s Mysql) Goals() ([]storage.Goal, error) {
+
+	result, err := s.db.Query("SELECT id, site_id, name, event, page_pattern FROM top_goals")
+	if err != nil {
+		return nil, fmt.Errorf("on goals: %v", err)
+	}
+
+	defer result.Close()
+
+	var goals []storage.Goal
+
+	for result.Next() {
+		var g storage.Goal
+		if err := result.Scan(&g.ID, &g.SiteID, &g.Name, &g.Event, &g.Page); err != nil {
+			return nil, fmt.Errorf("on scan: %v", err)
+		}
+		goals = append(goals, g)
+	}
+	return goals, result.Err()
+}
+
+func (s Mysql) Domains() ([]storage.Domain, error) {
+
+	result, err := s.db.Query("SELECT site_id, domain FROM top_site_domains")
+	if err != nil {
+		return nil, fmt.Errorf("on domains: %v", err)
+	}
+
+	defer result.Close()
+
+	var domains []storage.Domain
+
+	for result.Next() {
+		var d storage.Domain
+		if err := result.Scan(&d.SiteID, &d.Name); err != nil {
+			return nil, fmt.Errorf("on scan: %v", err)
+		}
+		domains = append(domains, d)
+	}
+	return domains, result.Err()
+}
+
+func (s Mysql) SetDomains(siteID int, domains []string) (err error) {
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("on begin tx: %v", err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err := tx.Exec("DELETE FROM top_site_domains WHERE site_id = ?", siteID); err != nil {
+		return fmt.Errorf("on delete domains: %v", err)
+	}
+	for _, d := range domains {
+		if _, err := tx.Exec("INSERT IGNORE INTO top_site_domains (site_id, domain) VALUES (?,?)", siteID, d); err != nil {
+			return fmt.Errorf("on insert domain: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("on commit tx: %v", err)
+	}
+	return nil
+}
+
+func (s Mysql) SetSecret(siteID int, secret string) error {
+	if _, err := s.db.Exec("UPDATE top_sites SET sign_secret = ? WHERE id = ?", secret, siteID); err != nil {
+		return fmt.Errorf("on set secret: %v", err)
+	}
+	return nil
+}
+
+// ResetDays returns local date of the last daily reset by time zone name, empty name is the database location
+func (s Mysql) ResetDays() (map[string]string, error) {
+
+	result, err := s.db.Query("SELECT zone, DATE_FORMAT(day, '%Y-%m-%d') FROM top_resets")
+	if err != nil {
+		return nil, fmt.Errorf("on reset days: %v", err)
+	}
+
+	defer result.Close()
+
+	days := make(map[string]string)
+	for result.Next() {
+		var zone, day string
+		if err := result.Scan(&zone, &day); err != nil {
+			return nil, fmt.Errorf("on scan: %v", err)
+		}
+		days[zone] = day
+	}
+	return days, result.Err()
+}
+
+func (s Mysql) SetResetDay(zone, day string) error {
+	if _, err := s.db.Exec("INSERT INTO top_resets (zone, day) VALUES (?, ?) ON DUPLICATE KEY UPDATE day = VALUES(day)", zone, day); err != nil {
+		return fmt.Errorf("on set reset day: %v", err)
+	}
+	return nil
+}
+
 func (s Mysql) Populate(lastID int) ([]storage.Site, error) {
 
-	result, err := s.db.Query("SELECT id, counter_id, visitors, hits, show_digits FROM top_sites WHERE id > ?", lastID)
+	result, err := s.db.Query("SELECT id, counter_id, visitors, hits, show_digits, counter_mode, cookieless, opt_out_policy, strict_referer, sign_secret, sign_max_age, timezone FROM top_sites WHERE id > ?", lastID)
 	if err != nil {
 		return nil, fmt.Errorf("on populate: %v", err)
 	}
@@ -104,18 +259,30 @@ func (s Mysql) Populate(lastID int) ([]storage.Site, error) {
 	for result.Next() {
 
 		var (
-			site storage.Site
+			id, counterID, hosts, hits int
+			digits, cookieless, strict bool
+			mode                       storage.CounterMode
+			optOut                     storage.OptOutPolicy
+			secret, timezone           string
+			maxAge                     int
 		)
 
-		if err := result.Scan(&site.ID, &site.CounterID, &site.Hosts, &site.Hits, &site.Digits); err != nil {
+		if err := result.Scan(&id, &counterID, &hosts, &hits, &digits, &mode, &cookieless, &optOut, &strict, &secret, &maxAge, &timezone); err != nil {
 			return nil, fmt.Errorf("on scan: %v", err)
 		}
-		sites = append(sites, site)
+		sites = append(sites, storage.NewSite(id, counterID, hosts, hits, digits))
+		sites[len(sites)-1].Mode = mode
+		sites[len(sites)-1].Cookieless = cookieless
+		sites[len(sites)-1].OptOut = optOut
+		sites[len(sites)-1].StrictReferer = strict
+		sites[len(sites)-1].Secret = secret
+		sites[len(sites)-1].SignMaxAge = time.Duration(maxAge) * time.Second
+		sites[len(sites)-1].Timezone = timezone
 	}
 	return sites, nil
 }
 
-func (s Mysql) UpdateSites(sites []storage.Site) error {
+func (s Mysql) UpdateSites(sites []storage.SiteStat) error {
 
 	if len(sites) == 0 {
 		return nil
@@ -152,10 +319,25 @@ func (s Mysql) UpdateSites(sites []storage.Site) error {
 	return nil
 }
 
+// Ping checks database connection
+func (s Mysql) Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return s.db.PingContext(ctx)
+}
+
 func (s *Mysql) Close() error {
 	return s.db.Close()
 }
 
+// ipString formats address, omitted address is stored as empty string
+func ipString(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
+
 func toDays(t time.Time, location *time.Location) int64 {
 	//mysql analog of TO_DAYS(time)
 	t = t.In(location)
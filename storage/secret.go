@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/felicson/topd/internal/sign"
+)
+
+// SignatureRequired reports whether counter urls of the site must be signed
+func (s *Site) SignatureRequired() bool {
+	s.l.RLock()
+	defer s.l.RUnlock()
+	return s.Secret != ""
+}
+
+// VerifySignature checks signature of counter url query and its age, any query is valid without secret.
+// Max age of the site overrides the given one, signatures do not expire when both are not set.
+func (s *Site) VerifySignature(query url.Values, now time.Time, maxAge time.Duration) bool {
+	s.l.RLock()
+	secret := s.Secret
+	if s.SignMaxAge > 0 {
+		maxAge = s.SignMaxAge
+	}
+	s.l.RUnlock()
+	return secret == "" || sign.Verify(secret, query, now, maxAge)
+}
+
+// Sign returns signature of counter url query made with the site secret
+func (s *Site) Sign(query url.Values) (string, error) {
+	s.l.RLock()
+	secret := s.Secret
+	s.l.RUnlock()
+	if secret == "" {
+		return "", ErrNoSecret
+	}
+	return sign.Sign(secret, query)
+}
+
+// RotateSecret saves new random secret of the site invalidating all issued signatures
+func (sm *SiteAggregate) RotateSecret(siteID int) (string, error) {
+	secret, err := sign.NewSecret()
+	if err != nil {
+		return "", err
+	}
+	return secret, sm.setSecret(siteID, secret)
+}
+
+// RemoveSecret makes signature of the site counter urls optional
+func (sm *SiteAggregate) RemoveSecret(siteID int) error {
+	return sm.setSecret(siteID, "")
+}
+
+func (sm *SiteAggregate) setSecret(siteID int, secret string) error {
+	site, ok := sm.Get(siteID)
+	if !ok {
+		return ErrUnknownSite
+	}
+	if err := sm.storage.SetSecret(siteID, secret); err != nil {
+		return err
+	}
+	site.l.Lock()
+	site.Secret = secret
+	site.l.Unlock()
+	return nil
+}
@@ -12,16 +12,20 @@ type SessionsPerSite struct {
 // CheckSession checking session in hash
 func (sps *SessionsPerSite) CheckSession(siteID int, session string) bool {
 
-	if site, ok := sps.sessions[siteID]; ok {
-		if _, ok = site[session]; ok {
-			return ok
-		}
+	sps.lock.RLock()
+	_, ok := sps.sessions[siteID][session]
+	sps.lock.RUnlock()
+	if ok {
+		return ok
 	}
 
 	sps.lock.Lock()
+	defer sps.lock.Unlock()
+	// the same session may be added by a concurrent hit after the read lock is released
+	if _, ok := sps.sessions[siteID][session]; ok {
+		return true
+	}
 	sps.append(siteID, session)
-	sps.lock.Unlock()
-
 	return false
 }
 
@@ -32,6 +36,15 @@ func (sps *SessionsPerSite) Reset() error {
 	return nil
 }
 
+// ResetSites forgets sessions of the sites
+func (sps *SessionsPerSite) ResetSites(ids []int) {
+	sps.lock.Lock()
+	for _, id := range ids {
+		delete(sps.sessions, id)
+	}
+	sps.lock.Unlock()
+}
+
 func (sps *SessionsPerSite) append(siteID int, session string) {
 
 	if _, ok := sps.sessions[siteID]; !ok {
@@ -4,21 +4,31 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
-
-	"github.com/felicson/topd/image"
 )
 
 var (
-	ErrHistoryCollectorStopped = errors.New("history collector stopped")
+	ErrHistoryCollectorStopped   = errors.New("history collector stopped")
+	ErrHistoryCollectorSaturated = errors.New("history collector queue is full")
+	ErrUnknownSite               = errors.New("unknown site")
+	ErrNoSecret                  = errors.New("site has no secret")
 )
 
 type Storage interface {
 	Populate(int) ([]Site, error)
-	UpdateSites([]Site) error
+	UpdateSites([]SiteStat) error
 	SaveData([]TopData) error
+	SaveEvents([]Event) error
+	Goals() ([]Goal, error)
+	Domains() ([]Domain, error)
+	SetDomains(siteID int, domains []string) error
+	SetSecret(siteID int, secret string) error
+	ResetDays() (map[string]string, error)
+	SetResetDay(zone, day string) error
 }
 
 type TopDataCollection []TopData
@@ -32,20 +42,229 @@ type TopData struct {
 	SiteID   int
 	IP       net.IP
 	UA       string
+	Screen   string
+	Lang     string
+	Title    string
+	Flags    HitFlag
 	Date     time.Time
 }
 
+// HitFlag marks hits saved to history but not counted
+type HitFlag uint8
+
+const (
+	// FlagExcess is set on hits over the rate limit
+	FlagExcess HitFlag = 1 << iota
+	// FlagSpam is set on hits with blocklisted referrer
+	FlagSpam
+	// FlagForeign is set on hits from domains not allowed for the site
+	FlagForeign
+)
+
+// CounterMode defines what the client receives on a hit
+type CounterMode uint8
+
+const (
+	// CounterImage renders counter image with hits and hosts
+	CounterImage CounterMode = iota
+	// CounterPixel returns transparent 1x1 gif
+	CounterPixel
+	// CounterBeacon returns empty 204 response
+	CounterBeacon
+)
+
+// ParseCounterMode converts request value to CounterMode
+func ParseCounterMode(mode string) (CounterMode, bool) {
+	switch mode {
+	case "image":
+		return CounterImage, true
+	case "pixel":
+		return CounterPixel, true
+	case "beacon":
+		return CounterBeacon, true
+	}
+	return CounterImage, false
+}
+
+// OptOutPolicy defines how hits with Do Not Track or Global Privacy Control signals are stored
+type OptOutPolicy uint8
+
+const (
+	// OptOutIgnore records opted out hits as usual
+	OptOutIgnore OptOutPolicy = iota
+	// OptOutAnonymous counts hits without storing history
+	OptOutAnonymous
+	// OptOutStrip counts hits and stores history without visitor identifying data
+	OptOutStrip
+)
+
 type Site struct {
-	Hosts     int
-	Hits      int
+	Hosts         int
+	Hits          int
+	ID            int
+	CounterID     int
+	Digits        bool
+	Mode          CounterMode
+	Cookieless    bool // track visitors by daily hash instead of cookie
+	OptOut        OptOutPolicy
+	StrictReferer bool          // hits without referer and page are not counted
+	Secret        string        // hex key of counter url signature, empty when signature is not required
+	SignMaxAge    time.Duration // signed urls expire after it when set, config max age is used otherwise
+	Timezone      string        // daily reset zone, database location when empty
+	optedOut      int           // daily hits with opt out signals
+	goals         []Goal
+	domains       []string
+	events        map[string]int // daily events count by name
+	converted     map[string]int // daily conversions by goal name
+	l             sync.RWMutex
+}
+
+// SiteSettings is a point in time copy of the site settings,
+// they are refreshed from the storage on every Init while counters are kept
+type SiteSettings struct {
+	CounterID     int
+	Digits        bool
+	Mode          CounterMode
+	Cookieless    bool
+	OptOut        OptOutPolicy
+	StrictReferer bool
+	SignMaxAge    time.Duration
+	Timezone      string
+}
+
+// Settings returns consistent copy of the site settings
+func (s *Site) Settings() SiteSettings {
+	s.l.RLock()
+	defer s.l.RUnlock()
+	return SiteSettings{
+		CounterID:     s.CounterID,
+		Digits:        s.Digits,
+		Mode:          s.Mode,
+		Cookieless:    s.Cookieless,
+		OptOut:        s.OptOut,
+		StrictReferer: s.StrictReferer,
+		SignMaxAge:    s.SignMaxAge,
+		Timezone:      s.Timezone,
+	}
+}
+
+// setSettings copies settings and secret of the site loaded from the storage
+func (s *Site) setSettings(src *Site) {
+	s.l.Lock()
+	s.CounterID = src.CounterID
+	s.Digits = src.Digits
+	s.Mode = src.Mode
+	s.Cookieless = src.Cookieless
+	s.OptOut = src.OptOut
+	s.StrictReferer = src.StrictReferer
+	s.Secret = src.Secret
+	s.SignMaxAge = src.SignMaxAge
+	s.Timezone = src.Timezone
+	s.l.Unlock()
+}
+
+// SiteStat is a point in time copy of the site counters
+type SiteStat struct {
 	ID        int
 	CounterID int
+	Hits      int
+	Hosts     int
 	Digits    bool
-	l         sync.RWMutex
+	OptedOut  int
+	Signed    bool
+	Domains   []string       `json:",omitempty"`
+	Events    map[string]int `json:",omitempty"`
+	Goals     map[string]int `json:",omitempty"`
+}
+
+// Stat returns consistent copy of the site counters
+func (s *Site) Stat() SiteStat {
+	s.l.RLock()
+	defer s.l.RUnlock()
+	return SiteStat{
+		ID:        s.ID,
+		CounterID: s.CounterID,
+		Hits:      s.Hits,
+		Hosts:     s.Hosts,
+		Digits:    s.Digits,
+		OptedOut:  s.optedOut,
+		Signed:    s.Secret != "",
+		Domains:   append([]string(nil), s.domains...),
+		Events:    copyCounts(s.events),
+		Goals:     copyCounts(s.converted),
+	}
+}
+
+func copyCounts(src map[string]int) map[string]int {
+	if len(src) == 0 {
+		return nil
+	}
+	dst := make(map[string]int, len(src))
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
+
+// TrackEvent counts the event and conversions of the goals bound to it
+func (s *Site) TrackEvent(name string) {
+
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if s.events == nil {
+		s.events = make(map[string]int)
+	}
+	s.events[name]++
+
+	for _, g := range s.goals {
+		if g.matchEvent(name) {
+			s.convert(g.Name)
+		}
+	}
+}
+
+// TrackPage counts conversions of the goals matching the page
+func (s *Site) TrackPage(page string) {
+
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	for _, g := range s.goals {
+		if g.matchPage(page) {
+			s.convert(g.Name)
+		}
+	}
+}
+
+func (s *Site) convert(goal string) {
+	if s.converted == nil {
+		s.converted = make(map[string]int)
+	}
+	s.converted[goal]++
+}
+
+func (s *Site) setGoals(goals []Goal) {
+	s.l.Lock()
+	s.goals = goals
+	s.l.Unlock()
+}
+
+// reset clears daily counters
+func (s *Site) reset() {
+	s.l.Lock()
+	s.Hits = 0
+	s.Hosts = 0
+	s.optedOut = 0
+	s.events = nil
+	s.converted = nil
+	s.l.Unlock()
 }
 
 //DisplayDigits check need to show digits on counter
 func (s *Site) DisplayDigits() bool {
+	s.l.RLock()
+	defer s.l.RUnlock()
 	return s.Digits
 }
 
@@ -62,6 +281,16 @@ func (s *Site) Increment(hosts bool, hits bool) {
 	}
 }
 
+// IncrementOptedOut counts anonymous hit of the visitor who opted out of tracking
+func (s *Site) IncrementOptedOut() {
+
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	s.Hits += 1
+	s.optedOut += 1
+}
+
 func NewSite(id, counterID, visitors, hits int, digits bool) Site {
 	return Site{
 		ID:        id,
@@ -72,51 +301,79 @@ func NewSite(id, counterID, visitors, hits int, digits bool) Site {
 	}
 }
 
+// RawTopData is a single hit as it received from the client
 type RawTopData struct {
-	page      string
-	referrer  string
-	xGeo      string
-	session   string
-	userAgent string
-	ip        net.IP
-	id        int
+	Page      string
+	Referrer  string
+	XGeo      string
+	Session   string
+	UserAgent string
+	IP        net.IP
+	SiteID    int
+	Screen    string
+	Lang      string
+	Title     string
+	Flags     HitFlag
+	Date      time.Time // hit time, receive time is used when zero
 }
 
-func newHistoryRow(raw *RawTopData) TopData {
+// Stripped returns copy of the hit without visitor identifying data
+func (raw RawTopData) Stripped() RawTopData {
+	return RawTopData{
+		Page:     raw.Page,
+		Referrer: raw.Referrer,
+		SiteID:   raw.SiteID,
+		Title:    raw.Title,
+		Flags:    raw.Flags,
+		Date:     raw.Date,
+	}
+}
+
+// ParseGeo extracts city id and country code from X-Geo header value like "RU-213"
+func ParseGeo(xGeo string) (int, string) {
 
 	cityID := 0
 	country := "0"
 
-	if city := raw.xGeo; city != "" && city != "0" {
+	if city := xGeo; len(city) >= 3 {
 		cityID, _ = strconv.Atoi(city[3:])
 		country = city[:2]
 	}
+	return cityID, country
+}
+
+func newHistoryRow(raw *RawTopData) TopData {
+
+	cityID, country := ParseGeo(raw.XGeo)
+
+	date := raw.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
 
 	return TopData{
-		Page:     raw.page,
-		Referrer: raw.referrer,
-		Sess:     raw.session,
+		Page:     raw.Page,
+		Referrer: raw.Referrer,
+		Sess:     raw.Session,
 		City:     cityID,
 		Country:  country,
-		SiteID:   raw.id,
-		IP:       raw.ip,
-		UA:       raw.userAgent,
-		Date:     time.Now(),
+		SiteID:   raw.SiteID,
+		IP:       raw.IP,
+		UA:       raw.UserAgent,
+		Screen:   raw.Screen,
+		Lang:     raw.Lang,
+		Title:    raw.Title,
+		Flags:    raw.Flags,
+		Date:     date,
 	}
 }
 
 type SiteAggregate struct {
 	lock    sync.RWMutex
 	sites   map[int]*Site
-	lastID  int
-	images  image.ImageList
 	storage Storage
 }
 
-func (sm *SiteAggregate) GetImage(id int) (image.Image, error) {
-	return sm.images.GetImage(uint(id))
-}
-
 //Get SiteID by id
 func (sm *SiteAggregate) Get(key int) (*Site, bool) {
 	sm.lock.RLock()
@@ -131,6 +388,21 @@ func (sm *SiteAggregate) Set(key int, d *Site) {
 	sm.sites[key] = d
 }
 
+// List returns counters of all known sites ordered by id
+func (sm *SiteAggregate) List() []SiteStat {
+	sm.lock.RLock()
+	stats := make([]SiteStat, 0, len(sm.sites))
+	for _, site := range sm.sites {
+		stats = append(stats, site.Stat())
+	}
+	sm.lock.RUnlock()
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].ID < stats[j].ID
+	})
+	return stats
+}
+
 //Reset sites statistic
 func (sm *SiteAggregate) Reset() bool {
 
@@ -138,24 +410,58 @@ func (sm *SiteAggregate) Reset() bool {
 	defer sm.lock.Unlock()
 
 	for _, v := range sm.sites {
-
-		v.Hits = 0
-		v.Hosts = 0
+		v.reset()
 	}
 	return true
 }
 
+// Timezones returns distinct non default time zones of the sites
+func (sm *SiteAggregate) Timezones() []string {
+
+	sm.lock.RLock()
+	defer sm.lock.RUnlock()
+
+	seen := make(map[string]struct{})
+	var zones []string
+	for _, site := range sm.sites {
+		if _, ok := seen[site.Timezone]; ok || site.Timezone == "" {
+			continue
+		}
+		seen[site.Timezone] = struct{}{}
+		zones = append(zones, site.Timezone)
+	}
+	sort.Strings(zones)
+	return zones
+}
+
+// ResetTimezone resets statistic of the sites in the zone and returns their ids
+func (sm *SiteAggregate) ResetTimezone(zone string) []int {
+
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+
+	var ids []int
+	for id, site := range sm.sites {
+		if site.Timezone != zone {
+			continue
+		}
+		site.reset()
+		ids = append(ids, id)
+	}
+	return ids
+}
+
 // KeepState saves in the storage current hits and hosts values of the sites
 func (sm *SiteAggregate) KeepState() error {
 
 	sm.lock.Lock()
-	var sites []Site
+	var sites []SiteStat
 	for k := range sm.sites {
-		site := sm.sites[k]
-		if site.Hosts == 0 {
+		stat := sm.sites[k].Stat()
+		if stat.Hosts == 0 {
 			continue
 		}
-		sites = append(sites, *site)
+		sites = append(sites, stat)
 	}
 	sm.lock.Unlock()
 	if err := sm.storage.UpdateSites(sites); err != nil {
@@ -165,28 +471,65 @@ func (sm *SiteAggregate) KeepState() error {
 }
 
 // Init populate SiteAggregate from storage.
-// On first call it receiving all records from storage, on another calls only new ones.
-func (sm *SiteAggregate) Init() {
+// New sites are added with their stored counters, already loaded sites get fresh settings
+// and keep their counters.
+// Init loads sites, goals and domains, each part is loaded even when another one fails
+// and every failure is reported in the returned error
+func (sm *SiteAggregate) Init() error {
 
 	sm.lock.Lock()
 	defer sm.lock.Unlock()
-	sites, _ := sm.storage.Populate(sm.lastID)
+
+	var failed []string
+	sites, err := sm.storage.Populate(0)
+	if err != nil {
+		failed = append(failed, fmt.Sprintf("on populate sites: %v", err))
+	}
 
 	for i := range sites {
 		site := &sites[i]
-		if site.ID > sm.lastID {
-			sm.lastID = site.ID
+		if current, ok := sm.sites[site.ID]; ok {
+			current.setSettings(site)
+			continue
+		}
+		sm.sites[site.ID] = site
+	}
+
+	// sites keep previous goals and domains when loading fails
+	if goals, err := sm.storage.Goals(); err != nil {
+		failed = append(failed, fmt.Sprintf("on load goals: %v", err))
+	} else {
+		bySite := make(map[int][]Goal)
+		for _, g := range goals {
+			bySite[g.SiteID] = append(bySite[g.SiteID], g)
+		}
+		for id, site := range sm.sites {
+			site.setGoals(bySite[id])
 		}
-		s := NewSite(site.ID, site.CounterID, site.Hosts, site.Hits, site.Digits)
-		sm.sites[site.ID] = &s
 	}
+
+	if domains, err := sm.storage.Domains(); err != nil {
+		failed = append(failed, fmt.Sprintf("on load domains: %v", err))
+	} else {
+		domainsBySite := make(map[int][]string)
+		for _, d := range domains {
+			domainsBySite[d.SiteID] = append(domainsBySite[d.SiteID], d.Name)
+		}
+		for id, site := range sm.sites {
+			site.setDomains(domainsBySite[id])
+		}
+	}
+
+	if len(failed) > 0 {
+		return errors.New(strings.Join(failed, "; "))
+	}
+	return nil
 }
 
 //NewSiteAggregate gen new struct from db
-func NewSiteAggregate(storage Storage, images image.ImageList) SiteAggregate {
+func NewSiteAggregate(storage Storage) SiteAggregate {
 	return SiteAggregate{
 		sites:   make(map[int]*Site),
-		images:  images,
 		storage: storage,
 	}
 }
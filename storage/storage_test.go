@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+// populateStub returns copies of its sites on every Populate call
+type populateStub struct {
+	Storage
+	sites []Site
+}
+
+func (s *populateStub) Populate(_ int) ([]Site, error) {
+	sites := make([]Site, len(s.sites))
+	for i := range s.sites {
+		src := &s.sites[i]
+		sites[i] = NewSite(src.ID, src.CounterID, src.Hosts, src.Hits, src.Digits)
+		sites[i].setSettings(src)
+	}
+	return sites, nil
+}
+
+func (s *populateStub) Goals() ([]Goal, error)     { return nil, nil }
+func (s *populateStub) Domains() ([]Domain, error) { return nil, nil }
+
+func TestSiteAggregateInit(t *testing.T) {
+	store := &populateStub{sites: []Site{NewSite(1, 1, 5, 10, true)}}
+	sm := NewSiteAggregate(store)
+	if err := sm.Init(); err != nil {
+		t.Fatal(err)
+	}
+	site, ok := sm.Get(1)
+	if !ok {
+		t.Fatal("site 1 is not loaded")
+	}
+	site.Increment(true, true)
+
+	store.sites[0] = NewSite(1, 3, 0, 0, false)
+	store.sites[0].Mode = CounterBeacon
+	store.sites[0].Cookieless = true
+	store.sites[0].OptOut = OptOutStrip
+	store.sites[0].StrictReferer = true
+	store.sites[0].Secret = "00ff"
+	store.sites[0].SignMaxAge = time.Hour
+	store.sites[0].Timezone = "Europe/Moscow"
+	store.sites = append(store.sites, NewSite(2, 2, 1, 1, true))
+	if err := sm.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	if current, _ := sm.Get(1); current != site {
+		t.Fatal("loaded site is replaced")
+	}
+	want := SiteSettings{
+		CounterID:     3,
+		Mode:          CounterBeacon,
+		Cookieless:    true,
+		OptOut:        OptOutStrip,
+		StrictReferer: true,
+		SignMaxAge:    time.Hour,
+		Timezone:      "Europe/Moscow",
+	}
+	if got := site.Settings(); got != want {
+		t.Errorf("unexpected settings %+v", got)
+	}
+	if !site.SignatureRequired() {
+		t.Error("secret is not refreshed")
+	}
+	if stat := site.Stat(); stat.Hits != 11 || stat.Hosts != 6 {
+		t.Errorf("counters are not kept: %+v", stat)
+	}
+	if stat, ok := sm.Get(2); !ok || stat.Stat().Hits != 1 {
+		t.Error("new site is not added with stored counters")
+	}
+}
@@ -3,12 +3,30 @@ package topd
 import (
 	"context"
 	"fmt"
-	"net"
 	"net/http"
-	"os"
 	"time"
+
+	"github.com/felicson/topd/image"
+	"github.com/felicson/topd/internal/activity"
+	"github.com/felicson/topd/internal/config"
+	"github.com/felicson/topd/internal/metrics"
+	"github.com/felicson/topd/internal/ratelimit"
+	"github.com/felicson/topd/internal/realip"
+	"github.com/felicson/topd/internal/session"
 )
 
+// recentHits is number of the latest hits kept per site for dashboard
+const recentHits = 50
+
+// liveBuffer is number of hits queued per live subscriber before dropping
+const liveBuffer = 64
+
+// renderCache is default number of encoded counters kept in memory
+const renderCache = 4096
+
+// referrerReload is how often referrer blocklist file is checked for changes
+const referrerReload = 30 * time.Second
+
 //NotFound handler
 func NotFound(w http.ResponseWriter, _ *http.Request) {
 	http.Error(w, "404 page not found", http.StatusNotFound)
@@ -17,72 +35,114 @@ func NotFound(w http.ResponseWriter, _ *http.Request) {
 //Run start web server
 func Run(ctx context.Context, deps Deps, done chan struct{}) error {
 
-	config := deps.GetConfig()
+	conf := deps.GetConfig()
 	logger := deps.GetLogger()
 
-	if _, err := os.Stat(config.Socket); err == nil {
-		logger.Info("Trying to remove exist socket file")
-		if err := os.Remove(config.Socket); err != nil {
-			return fmt.Errorf("on remove socket file: %v", err)
-		}
-	}
-
-	addr, err := net.ResolveUnixAddr("unix", config.Socket)
+	ipResolver, err := realip.NewResolver(conf.TrustedProxies)
 	if err != nil {
-		return err
+		return fmt.Errorf("on build ip resolver: %v", err)
 	}
 
-	ln, err := net.ListenUnix("unix", addr)
-
-	//tcpAddr, _ := net.ResolveTCPAddr("tcp", "0.0.0.0:8081")
-	//ln, err := net.ListenTCP("tcp", tcpAddr)
-
+	location, err := time.LoadLocation(conf.DatabaseLocation)
 	if err != nil {
-		return fmt.Errorf("create socket: %v", err)
+		return fmt.Errorf("on load location: %v", err)
 	}
-	defer ln.Close()
 
-	if err = os.Chmod(config.Socket, 0777); err != nil {
-		return fmt.Errorf("chmod socket: %v", err)
+	state := liveState{
+		config:    conf,
+		bots:      deps.GetBotChecker(),
+		referrers: deps.GetReferrerBlocklist(),
+		images:    deps.GetImages(),
 	}
 
-	errChannel := make(chan error, 1)
-
 	web := Web{
 		siteMap:        deps.GetSiteCollection(),
 		sessionPerSite: deps.GetSessionPerSite(),
 		historyWriter:  deps.GetHistoryWriter(),
-		bots:           deps.GetBotChecker(),
 		logger:         logger,
-		config:         config,
+		config:         newLiveConfig(state),
+		checks:         deps.GetHealthChecks(),
+		ipResolver:     ipResolver,
+		visitors:       session.NewDailyHasher(location),
+		recent:         activity.NewRecent(recentHits),
+		live: activity.NewHub(liveBuffer, func() {
+			metrics.LiveDropped.Inc()
+		}),
 	}
 
-	mux := http.NewServeMux()
-	mux.HandleFunc("/top/", web.logHandler(web.ErrHandler(web.TopServer)))
-	mux.HandleFunc("/", NotFound)
-
-	server := http.Server{
-		Handler: mux,
+	cacheSize := conf.RenderCache
+	if cacheSize <= 0 {
+		cacheSize = renderCache
 	}
+	web.renders = image.NewCache(cacheSize, func() {
+		metrics.RenderCacheMisses.Inc()
+	})
 
-	go func(ln net.Listener) {
-		if err = server.Serve(ln); err != nil {
-			errChannel <- fmt.Errorf("listenAndServe start: %v", err)
+	if limit := conf.RateLimit; limit != nil {
+		if limit.IP.Rate > 0 {
+			web.ipLimit = ratelimit.New(limit.IP.Rate, limit.IP.Burst, limit.Size)
+		}
+		if limit.Site.Rate > 0 {
+			web.siteLimit = ratelimit.New(limit.Site.Rate, limit.Site.Burst, limit.Size)
 		}
+	}
+
+	reload := reloader{
+		load:  deps.GetConfigLoader(),
+		level: deps.GetLogLevel(),
+		web:   &web,
+	}
+	go reload.watch(ctx)
+	if deps.GetReferrerBlocklist() != nil {
+		go reload.watchReferrers(ctx, referrerReload)
+	}
 
-	}(ln)
+	metrics.LiveSubscribers.Set(func() float64 {
+		return float64(web.live.Len())
+	})
+	metrics.RenderCacheEntries.Set(func() float64 {
+		return float64(web.renders.Len())
+	})
 
-	select {
-	case err := <-errChannel:
-		return err
-	case <-done:
-		_ = os.Remove(config.Socket)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/top/", instrument("top", web.logHandler(web.ErrHandler(web.TopServer))))
+	mux.HandleFunc("/top.js", instrument("script", web.ScriptServer))
+	mux.HandleFunc("/collect", instrument("collect", web.logHandler(web.CollectServer)))
+	mux.HandleFunc("/event/", instrument("event", web.logHandler(web.EventServer)))
+	mux.HandleFunc("/live/", instrument("live", web.logHandler(web.liveAccess(web.LiveServer))))
+	mux.HandleFunc("/api/sites", instrument("api_sites", web.logHandler(web.readOnly(web.SitesServer))))
+	mux.HandleFunc(apiSitesPath, instrument("api_site", web.logHandler(web.readOnly(web.SiteServer))))
+	mux.HandleFunc("/healthz", web.HealthServer)
+	mux.HandleFunc("/readyz", web.ReadyServer)
+	mux.HandleFunc("/", NotFound)
+
+	endpoints := []endpoint{
+		{handler: mux, listeners: conf.WebListeners(), shutdown: web.live.Close},
+	}
+	if conf.Metrics != nil {
+		endpoints = append(endpoints, endpoint{
+			handler:   metrics.Handler(),
+			listeners: []config.Listener{*conf.Metrics},
+		})
 	}
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
 
-	if err := server.Shutdown(ctx); err != nil {
-		return fmt.Errorf("shutdown server: %v", err)
+	if conf.Admin != nil {
+		admin := Admin{
+			siteMap: web.siteMap,
+			history: deps.GetHistoryWriter(),
+			flush:   deps.GetFlushReporter(),
+			recent:  web.recent,
+			reload:  reload.Reload,
+			live:    web.LiveServer,
+			config:  *conf.Admin,
+			logger:  logger,
+		}
+		endpoints = append(endpoints, endpoint{
+			handler:   admin.mux(),
+			listeners: []config.Listener{conf.Admin.Listener},
+			shutdown:  web.live.Close,
+		})
 	}
-	return nil
+
+	return serve(ctx, endpoints, logger, done)
 }
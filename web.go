@@ -2,43 +2,103 @@ package topd
 
 import (
 	"bytes"
+	"context"
 	"net"
 	"net/http"
 	"net/url"
 	"strconv"
 	"time"
 
-	"github.com/felicson/topd/internal/bot"
+	"github.com/felicson/topd/image"
+	"github.com/felicson/topd/internal/activity"
 	"github.com/felicson/topd/internal/config"
 	"github.com/felicson/topd/internal/log"
+	"github.com/felicson/topd/internal/metrics"
+	"github.com/felicson/topd/internal/ratelimit"
+	"github.com/felicson/topd/internal/realip"
+	"github.com/felicson/topd/internal/referrer"
 	"github.com/felicson/topd/internal/session"
 	"github.com/felicson/topd/storage"
 )
 
+// transparentPixel is 1x1 transparent gif
+var transparentPixel = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
 type historyWriter interface {
-	WriteHistory(page, referrer, xGeo, session, userAgent string, ip net.IP, siteID int) error
+	WriteHistory(data storage.RawTopData) error
+	WriteEvent(event storage.Event) error
 }
 
 type Web struct {
 	siteMap        *storage.SiteAggregate
 	sessionPerSite *storage.SessionsPerSite
-	config         config.Config
+	config         *liveConfig // config, bots, referrers and images replaced on reload
 	historyWriter  historyWriter
-	bots           *bot.Checker
 	logger         log.Logger
+	checks         []HealthCheck
+	ipResolver     realip.Resolver
+	visitors       *session.DailyHasher
+	recent         *activity.Recent
+	live           *activity.Hub
+	renders        *image.Cache
+	ipLimit        *ratelimit.Limiter // nil when client ip is not limited
+	siteLimit      *ratelimit.Limiter // nil when site is not limited
 }
 
+type ctxKey int
+
+const (
+	clientIPKey ctxKey = iota
+	stateKey
+)
+
 func (web *Web) logHandler(next http.HandlerFunc) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, req *http.Request) {
 
-		ip := req.Header.Get("X-Real-IP")
+		ip := web.ipResolver.ClientIP(req)
+		ctx := context.WithValue(req.Context(), clientIPKey, ip)
+		// whole request is served with one state even when reload happens meanwhile
+		req = req.WithContext(context.WithValue(ctx, stateKey, web.config.Load()))
 		start := time.Now()
 		next(w, req)
 		web.logger.Infof("%s [%s] %s %v", ip, req.Method, req.URL.String(), time.Now().Sub(start))
 	}
 }
 
+// statusWriter remembers response status code
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (sw *statusWriter) WriteHeader(code int) {
+	sw.code = code
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *statusWriter) Flush() {
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// instrument collects request count and latency of the handler
+func instrument(name string, next http.HandlerFunc) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+		start := time.Now()
+		next(sw, req)
+		metrics.HTTPDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+		metrics.HTTPRequests.WithLabelValues(name, strconv.Itoa(sw.code)).Inc()
+	}
+}
+
 func (web *Web) ErrHandler(fn func(http.ResponseWriter, *http.Request)) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, req *http.Request) {
@@ -46,15 +106,37 @@ func (web *Web) ErrHandler(fn func(http.ResponseWriter, *http.Request)) http.Han
 		reqSiteID := req.FormValue("id")
 		siteID, _ := strconv.Atoi(reqSiteID)
 
-		if _, ok := web.siteMap.Get(siteID); !ok {
-			// return first image with zero values
-			image, _ := web.siteMap.GetImage(1)
-			if err := image.Draw(w, 0, 0); err != nil {
+		site, ok := web.siteMap.Get(siteID)
+		if !ok {
+			metrics.UnknownSites.Inc()
+			if mode, ok := storage.ParseCounterMode(req.FormValue("mode")); ok && mode != storage.CounterImage {
+				web.writeCounter(w, req, mode, nil)
+				return
+			}
+			// return default counter with zero values
+			img, err := web.state(req).defaultImage()
+			if err != nil {
+				NotFound(w, req)
+				return
+			}
+			format := img.Output(counterFormat(w, req))
+			w.Header().Set("Content-Type", format.ContentType())
+			if err := web.renders.Render(w, img, format, 0, 0); err != nil {
 				web.logger.Error(err)
 			}
 			return
 		}
 
+		if !web.verifySignature(req, site, req.URL.Query()) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		if web.cookieless(req, site) || web.optOut(req, site) != storage.OptOutIgnore {
+			fn(w, req)
+			return
+		}
+
 		_, err := req.Cookie("sess")
 
 		if fwdFlag := req.FormValue("fw"); fwdFlag == "" && err != nil {
@@ -69,12 +151,12 @@ func (web *Web) ErrHandler(fn func(http.ResponseWriter, *http.Request)) http.Han
 			var buf bytes.Buffer
 			buf.WriteString(scheme)
 			buf.WriteString("://")
-			buf.WriteString(web.config.Host)
+			buf.WriteString(web.state(req).config.Host)
 			buf.WriteString(req.RequestURI)
 			buf.WriteString("&fw=1")
 
 			w.Header().Set("Location", buf.String())
-			http.SetCookie(w, initCookie(web.config.Domain))
+			http.SetCookie(w, initCookie(web.state(req).config.Domain))
 			w.WriteHeader(302)
 
 			return
@@ -87,51 +169,235 @@ func (web *Web) ErrHandler(fn func(http.ResponseWriter, *http.Request)) http.Han
 //TopServer http handler
 func (web *Web) TopServer(w http.ResponseWriter, req *http.Request) {
 
-	var hosts bool //hosts increment flag for Increment function
+	reqSiteID := req.FormValue("id")
+	siteID, _ := strconv.Atoi(reqSiteID)
+	val, _ := web.siteMap.Get(siteID)
+	sess, ip := web.visitor(req, val)
+
+	data := storage.RawTopData{
+		Page:      req.FormValue("p"),
+		Referrer:  req.FormValue("ref"),
+		XGeo:      req.Header.Get("X-Geo"),
+		Session:   sess,
+		UserAgent: req.UserAgent(),
+		IP:        ip,
+		SiteID:    siteID,
+		Screen:    truncate(req.FormValue("scr"), 11),
+		Lang:      truncate(req.FormValue("lang"), 35),
+		Title:     truncate(req.FormValue("t"), 255),
+	}
+	data.Flags = web.rateFlags(req, val) | web.domainFlags(req, val, data.Page)
+
+	web.track(web.state(req), val, data, data.Session, web.optOut(req, val))
+
+	mode := val.Settings().Mode
+	if reqMode, ok := storage.ParseCounterMode(req.FormValue("mode")); ok {
+		mode = reqMode
+	}
+	web.writeCounter(w, req, mode, val)
+}
+
+// counterFormat returns format from format param or Accept header preferring svg
+func counterFormat(w http.ResponseWriter, req *http.Request) image.Format {
+	if format, ok := image.ParseFormat(req.FormValue("format")); ok {
+		return format
+	}
+	w.Header().Add("Vary", "Accept")
+	if image.AcceptsSVG(req.Header.Get("Accept")) {
+		return image.FormatSVG
+	}
+	return image.FormatDefault
+}
+
+// state returns live state taken for the request by logHandler, the current one otherwise
+func (web *Web) state(req *http.Request) *liveState {
+	if state, ok := req.Context().Value(stateKey).(*liveState); ok {
+		return state
+	}
+	return web.config.Load()
+}
 
-	ip := req.Header.Get("X-Real-IP")
-	sessionValue := ip
+// clientIP returns client address resolved by logHandler
+func (web *Web) clientIP(req *http.Request) net.IP {
+	if ip, ok := req.Context().Value(clientIPKey).(net.IP); ok {
+		return ip
+	}
+	return web.ipResolver.ClientIP(req)
+}
 
+// rateFlags takes tokens for the hit from client ip and site buckets,
+// hit over any of the limits is marked as excess
+func (web *Web) rateFlags(req *http.Request, site *storage.Site) storage.HitFlag {
+	now := time.Now()
+	if web.ipLimit != nil && !web.ipLimit.Allow(web.clientIP(req).String(), now) {
+		return storage.FlagExcess
+	}
+	if web.siteLimit != nil && !web.siteLimit.Allow(strconv.Itoa(site.ID), now) {
+		return storage.FlagExcess
+	}
+	return 0
+}
+
+// domainFlags marks the hit as foreign when referer or page host is not allowed for the site,
+// hit without both of them is foreign only for the site in strict mode
+func (web *Web) domainFlags(req *http.Request, site *storage.Site, page string) storage.HitFlag {
+	refHost, pageHost := referrer.Host(req.Referer()), referrer.Host(page)
+	if refHost == "" && pageHost == "" {
+		if site.Settings().StrictReferer {
+			return storage.FlagForeign
+		}
+		return 0
+	}
+	for _, host := range []string{refHost, pageHost} {
+		if host != "" && !site.AllowedHost(host) {
+			return storage.FlagForeign
+		}
+	}
+	return 0
+}
+
+// cookieless reports whether the site visitors are tracked without cookie
+func (web *Web) cookieless(req *http.Request, site *storage.Site) bool {
+	return web.state(req).config.Cookieless || site.Settings().Cookieless
+}
+
+// verifySignature checks signed parameters of the query for sites with a secret
+func (web *Web) verifySignature(req *http.Request, site *storage.Site, query url.Values) bool {
+	if site.VerifySignature(query, time.Now(), web.state(req).config.SignatureMaxAge) {
+		return true
+	}
+	metrics.SignatureRejections.Inc()
+	return false
+}
+
+// optOut returns the site policy when the visitor sent Do Not Track or Global Privacy Control signal
+func (web *Web) optOut(req *http.Request, site *storage.Site) storage.OptOutPolicy {
+	if req.Header.Get("DNT") == "1" || req.Header.Get("Sec-GPC") == "1" {
+		return site.Settings().OptOut
+	}
+	return storage.OptOutIgnore
+}
+
+// visitor returns session key and client address allowed to be stored.
+// In cookieless mode the key is a daily salted hash and the address is omitted.
+func (web *Web) visitor(req *http.Request, site *storage.Site) (string, net.IP) {
+
+	ip := web.clientIP(req)
+	if web.cookieless(req, site) {
+		return web.visitors.Key(site.ID, site.Settings().Timezone, ip, req.UserAgent()), nil
+	}
 	if cookie, err := req.Cookie("sess"); err == nil {
-		sessionValue = cookie.Value
+		return cookie.Value, ip
+	}
+	if ip == nil {
+		return "", nil
 	}
+	return ip.String(), ip
+}
 
-	reqSiteID := req.FormValue("id")
-	siteID, _ := strconv.Atoi(reqSiteID)
-	page := req.FormValue("p")
-	ref := req.FormValue("ref")
-	xGeo := req.Header.Get("X-Geo")
+// track stores the hit in history and increments the site counters,
+// hosts are counted by server derived visitor session.
+// Bots, excess and foreign hits are never counted, opted out hits are counted
+// before the referrer spam check, so they reach OptedOut with any referrer.
+func (web *Web) track(state *liveState, site *storage.Site, data storage.RawTopData, visitor string, optOut storage.OptOutPolicy) {
 
-	if err := web.historyWriter.WriteHistory(page, ref, xGeo, sessionValue, req.UserAgent(), net.ParseIP(ip), siteID); err != nil {
-		web.logger.Error(err)
+	var hosts bool //hosts increment flag for Increment function
+
+	history := data
+	if optOut == storage.OptOutStrip {
+		history = data.Stripped()
 	}
+	bot := state.bots.BadUserAgent(data.UserAgent)
+	metrics.Hits.Inc()
 
-	val, _ := web.siteMap.Get(siteID)
+	spam := state.referrers != nil && state.referrers.Blocked(data.Referrer)
+	if spam {
+		history.Flags |= storage.FlagSpam
+	}
 
-	image, err := web.siteMap.GetImage(val.CounterID)
-	if err != nil {
-		web.logger.Error(err)
+	if optOut != storage.OptOutAnonymous && !(spam && state.config.ReferrerSpam != config.SpamFlag) {
+		if err := web.historyWriter.WriteHistory(history); err != nil {
+			web.logger.Error(err)
+		}
+		_, country := storage.ParseGeo(history.XGeo)
+		hit := activity.Hit{
+			Page:     history.Page,
+			Referrer: history.Referrer,
+			Country:  country,
+			Bot:      bot,
+			Date:     time.Now(),
+		}
+		web.recent.Add(site.ID, hit)
+		web.live.Publish(site.ID, hit)
+	}
+
+	if bot {
+		metrics.BotRejections.WithLabelValues("hit").Inc()
+		return
+	}
+	if history.Flags&storage.FlagExcess != 0 {
+		metrics.RateLimited.Inc()
+		return
+	}
+	if history.Flags&storage.FlagForeign != 0 {
+		metrics.ForeignHits.Inc()
+		return
+	}
+	if optOut != storage.OptOutIgnore {
+		site.IncrementOptedOut()
+		site.TrackPage(data.Page)
+		return
+	}
+	if spam {
+		// spam is counted as hit but never as host
+		metrics.ReferrerSpam.Inc()
+		site.Increment(false, true)
 		return
 	}
 
-	if ok := web.sessionPerSite.CheckSession(siteID, sessionValue); !ok {
+	if ok := web.sessionPerSite.CheckSession(site.ID, visitor); !ok {
 		hosts = true
 	}
-	if !web.bots.BadUserAgent(req.UserAgent()) {
-		val.Increment(hosts, true)
-	}
+	site.Increment(hosts, true)
+	site.TrackPage(data.Page)
+}
+
+// writeCounter responds to the hit according to the counter mode
+func (web *Web) writeCounter(w http.ResponseWriter, req *http.Request, mode storage.CounterMode, site *storage.Site) {
 
-	if val.DisplayDigits() {
-		if err := image.Draw(w, val.Hits, val.Hosts); err != nil {
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	switch mode {
+	case storage.CounterPixel:
+		w.Header().Set("Content-Type", "image/gif")
+		w.Header().Set("Cache-Control", "no-store")
+		if _, err := w.Write(transparentPixel); err != nil {
 			web.logger.Error(err)
 		}
 		return
+	case storage.CounterBeacon:
+		w.WriteHeader(http.StatusNoContent)
+		return
 	}
-	if err := image.Draw(w, 0, 0); err != nil {
+
+	img, err := web.state(req).images.GetImage(uint(site.Settings().CounterID))
+	if err != nil {
+		web.logger.Error(err)
+		return
+	}
+	format := img.Output(counterFormat(w, req))
+	w.Header().Set("Content-Type", format.ContentType())
+
+	hits, hosts := 0, 0
+	if site.DisplayDigits() {
+		stat := site.Stat()
+		hits, hosts = stat.Hits, stat.Hosts
+	}
+	start := time.Now()
+	if err := web.renders.Render(w, img, format, hits, hosts); err != nil {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		web.logger.Error(err)
+		return
 	}
+	metrics.ImageRender.Observe(time.Since(start).Seconds())
 }
 
 func initCookie(domain string) *http.Cookie {
@@ -149,3 +415,15 @@ func initCookie(domain string) *http.Cookie {
 		Expires: time.Date(now.Year()+maxYear, now.Month(), now.Day(), 23, 59, 59, 0, time.UTC),
 	}
 }
+
+// truncate cuts s to at most n runes
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
@@ -0,0 +1,411 @@
+package topd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/felicson/topd/image"
+	"github.com/felicson/topd/internal/config"
+	"github.com/felicson/topd/internal/ratelimit"
+	"github.com/felicson/topd/internal/referrer"
+	"github.com/felicson/topd/internal/sign"
+	"github.com/felicson/topd/storage"
+)
+
+func TestCookieRedirect(t *testing.T) {
+	web := newTestWeb(t)
+	handler := web.ErrHandler(web.TopServer)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/top/?id=1", nil))
+	if rec.Code != http.StatusFound || rec.Header().Get("Set-Cookie") == "" {
+		t.Fatalf("expected redirect with cookie, got %d", rec.Code)
+	}
+	if rows := web.historyWriter.(*historyRecorder).rows; len(rows) != 0 {
+		t.Errorf("hit recorded before redirect: %+v", rows)
+	}
+}
+
+func TestCookieless(t *testing.T) {
+	web := newTestWeb(t)
+	site, _ := web.siteMap.Get(2)
+	site.Cookieless = true
+	handler := web.ErrHandler(web.TopServer)
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/top/?id=2&mode=beacon", nil)
+		req.AddCookie(&http.Cookie{Name: "sess", Value: "tracked"})
+		handler(rec, req)
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("unexpected status %d", rec.Code)
+		}
+		if rec.Header().Get("Set-Cookie") != "" {
+			t.Error("cookie is set in cookieless mode")
+		}
+	}
+
+	rows := web.historyWriter.(*historyRecorder).rows
+	if len(rows) != 2 {
+		t.Fatalf("unexpected history %+v", rows)
+	}
+	for _, row := range rows {
+		if row.IP != nil || len(row.Session) != 16 || row.Session == "tracked" || row.Session != rows[0].Session {
+			t.Errorf("unexpected row %+v", row)
+		}
+	}
+	if stat := site.Stat(); stat.Hits != 2 || stat.Hosts != 1 {
+		t.Errorf("unexpected counters %+v", stat)
+	}
+}
+
+func TestOptOut(t *testing.T) {
+	web := newTestWeb(t)
+	handler := web.ErrHandler(web.TopServer)
+
+	anonymous, _ := web.siteMap.Get(1)
+	anonymous.OptOut = storage.OptOutAnonymous
+	stripped, _ := web.siteMap.Get(2)
+	stripped.OptOut = storage.OptOutStrip
+
+	for _, id := range []string{"1", "2"} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/top/?id="+id+"&mode=pixel&p=https://example.com/", nil)
+		req.Header.Set("Sec-GPC", "1")
+		req.Header.Set("User-Agent", "Mozilla/5.0")
+		handler(rec, req)
+		if rec.Code != http.StatusOK || rec.Header().Get("Set-Cookie") != "" {
+			t.Errorf("site %s: unexpected response %d %v", id, rec.Code, rec.Header())
+		}
+	}
+
+	rows := web.historyWriter.(*historyRecorder).rows
+	if len(rows) != 1 {
+		t.Fatalf("expected single stripped row, got %+v", rows)
+	}
+	if row := rows[0]; row.SiteID != 2 || row.Page != "https://example.com/" || row.Session != "" || row.IP != nil || row.UserAgent != "" {
+		t.Errorf("row is not stripped: %+v", row)
+	}
+
+	for _, site := range []*storage.Site{anonymous, stripped} {
+		if stat := site.Stat(); stat.Hits != 1 || stat.Hosts != 0 || stat.OptedOut != 1 {
+			t.Errorf("unexpected counters %+v", stat)
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	web := newTestWeb(t)
+	web.ipLimit = ratelimit.New(0, 2, 10)
+	handler := web.ErrHandler(web.TopServer)
+
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/top/?id=2", nil)
+		req.AddCookie(&http.Cookie{Name: "sess", Value: "abuser"})
+		handler(rec, req)
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/png" {
+			t.Fatalf("hit %d: unexpected response %d %v", i, rec.Code, rec.Header())
+		}
+	}
+
+	rows := web.historyWriter.(*historyRecorder).rows
+	if len(rows) != 3 || rows[1].Flags != 0 || rows[2].Flags != storage.FlagExcess {
+		t.Errorf("unexpected history %+v", rows)
+	}
+	site, _ := web.siteMap.Get(2)
+	if stat := site.Stat(); stat.Hits != 2 {
+		t.Errorf("excess hit is counted: %+v", stat)
+	}
+}
+
+func TestReferrerSpam(t *testing.T) {
+	dir, err := ioutil.TempDir("", "topd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "spam.txt")
+	if err := ioutil.WriteFile(file, []byte("spam.example\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	referrers, err := referrer.NewBlocklistFromFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, action := range []string{config.SpamDrop, config.SpamFlag} {
+		web := newTestWeb(t)
+		web.config.update(func(state *liveState) {
+			state.referrers = referrers
+		})
+		web.config.Set(config.Config{ReferrerSpam: action})
+		handler := web.ErrHandler(web.TopServer)
+
+		for _, ref := range []string{"https://www.spam.example/", "https://example.com/"} {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/top/?id=2&mode=beacon&ref="+url.QueryEscape(ref), nil)
+			req.AddCookie(&http.Cookie{Name: "sess", Value: "s" + strconv.Itoa(len(ref))})
+			handler(rec, req)
+		}
+
+		rows := web.historyWriter.(*historyRecorder).rows
+		switch action {
+		case config.SpamDrop:
+			if len(rows) != 1 || rows[0].Flags != 0 {
+				t.Errorf("drop: unexpected history %+v", rows)
+			}
+		case config.SpamFlag:
+			if len(rows) != 2 || rows[0].Flags != storage.FlagSpam || rows[1].Flags != 0 {
+				t.Errorf("flag: unexpected history %+v", rows)
+			}
+		}
+		site, _ := web.siteMap.Get(2)
+		if stat := site.Stat(); stat.Hits != 2 || stat.Hosts != 1 {
+			t.Errorf("%s: unexpected counters %+v", action, stat)
+		}
+
+		// opted out visitor with blocklisted referrer is counted as opted out
+		site.OptOut = storage.OptOutAnonymous
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/top/?id=2&mode=beacon&ref="+url.QueryEscape("https://spam.example/"), nil)
+		req.Header.Set("DNT", "1")
+		handler(rec, req)
+		if stat := site.Stat(); stat.Hits != 3 || stat.Hosts != 1 || stat.OptedOut != 1 {
+			t.Errorf("%s: opted out spam: unexpected counters %+v", action, stat)
+		}
+		if len(web.historyWriter.(*historyRecorder).rows) != len(rows) {
+			t.Errorf("%s: opted out spam is stored", action)
+		}
+	}
+}
+
+func TestAllowedDomains(t *testing.T) {
+	web := newTestWeb(t)
+	if err := web.siteMap.SetDomains(2, []string{"Example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	handler := web.ErrHandler(web.TopServer)
+
+	hit := func(page, referer string) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/top/?id=2&p="+url.QueryEscape(page), nil)
+		req.AddCookie(&http.Cookie{Name: "sess", Value: "visitor"})
+		if referer != "" {
+			req.Header.Set("Referer", referer)
+		}
+		handler(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("unexpected status %d", rec.Code)
+		}
+	}
+
+	hit("https://www.example.com/", "https://www.example.com/")
+	hit("", "https://example.com/page")
+	hit("https://example.com/", "https://evil.test/")
+	hit("https://notexample.com/", "")
+	hit("", "")
+
+	site, _ := web.siteMap.Get(2)
+	if stat := site.Stat(); stat.Hits != 3 {
+		t.Errorf("unexpected counters %+v", stat)
+	}
+	rows := web.historyWriter.(*historyRecorder).rows
+	if len(rows) != 5 || rows[2].Flags != storage.FlagForeign || rows[3].Flags != storage.FlagForeign || rows[4].Flags != 0 {
+		t.Errorf("unexpected history %+v", rows)
+	}
+
+	site.StrictReferer = true
+	hit("", "")
+	if stat := site.Stat(); stat.Hits != 3 {
+		t.Errorf("hit without referer is counted in strict mode: %+v", stat)
+	}
+
+	if err := web.siteMap.SetDomains(2, []string{"bad domain"}); err != storage.ErrWrongDomain {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestSignedCounter(t *testing.T) {
+	web := newTestWeb(t)
+	secret, err := web.siteMap.RotateSecret(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := func(query url.Values, issued time.Time) string {
+		sign.Stamp(query, issued)
+		sig, err := sign.Sign(secret, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		query.Set(sign.Param, sig)
+		return query.Encode()
+	}
+	beacon := signed(url.Values{"id": {"2"}, "mode": {"beacon"}}, time.Now())
+	expired := signed(url.Values{"id": {"2"}, "mode": {"beacon"}}, time.Now().Add(-2*time.Hour))
+	handler := web.ErrHandler(web.TopServer)
+	web.config.Set(config.Config{SignatureMaxAge: time.Hour})
+
+	for _, c := range []struct {
+		query  string
+		status int
+	}{
+		{beacon, http.StatusNoContent},
+		{beacon + "&p=https://x.test", http.StatusNoContent},
+		{"id=2&mode=beacon", http.StatusForbidden},
+		{strings.Replace(beacon, "mode=beacon", "mode=pixel", 1), http.StatusForbidden},
+		{expired, http.StatusForbidden},
+		{"id=1&mode=beacon", http.StatusNoContent},
+	} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/top/?"+c.query, nil)
+		req.AddCookie(&http.Cookie{Name: "sess", Value: "visitor"})
+		handler(rec, req)
+		if rec.Code != c.status {
+			t.Errorf("%s: expected %d, got %d", c.query, c.status, rec.Code)
+		}
+	}
+
+	for _, c := range []struct {
+		query  string
+		status int
+	}{
+		{beacon + "&name=signup", http.StatusNoContent},
+		{"id=2&name=signup", http.StatusForbidden},
+		{expired + "&name=signup", http.StatusForbidden},
+	} {
+		rec := httptest.NewRecorder()
+		web.EventServer(rec, httptest.NewRequest(http.MethodGet, "/event/?"+c.query, nil))
+		if rec.Code != c.status {
+			t.Errorf("event %s: expected %d, got %d", c.query, c.status, rec.Code)
+		}
+	}
+
+	collect := signed(url.Values{"id": {"2"}}, time.Now())
+	body := `[{"site_id": 2, "page": "https://example.com/"}, {"site_id": 1, "page": "https://example.com/"}]`
+	for _, c := range []struct {
+		path     string
+		accepted int
+	}{
+		{"/collect?" + collect, 2},
+		{"/collect", 1},
+	} {
+		rec := httptest.NewRecorder()
+		web.CollectServer(rec, httptest.NewRequest(http.MethodPost, c.path, strings.NewReader(body)))
+		var result collectResult
+		if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		if result.Accepted != c.accepted {
+			t.Errorf("%s: unexpected result %+v", c.path, result)
+		}
+		if c.accepted == 1 && (len(result.Errors) != 1 || result.Errors[0].Error != errWrongSignature.Error()) {
+			t.Errorf("%s: unexpected errors %+v", c.path, result.Errors)
+		}
+	}
+
+	// expiry is opt-in, max age of the site overrides the config one
+	unstamped := url.Values{"id": {"2"}, "mode": {"beacon"}}
+	sig, err := sign.Sign(secret, unstamped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unstamped.Set(sign.Param, sig)
+	site, _ := web.siteMap.Get(2)
+	for _, c := range []struct {
+		configAge, siteAge time.Duration
+		query              string
+		status             int
+	}{
+		{0, 0, expired, http.StatusNoContent},
+		{0, 0, unstamped.Encode(), http.StatusNoContent},
+		{time.Hour, 0, unstamped.Encode(), http.StatusForbidden},
+		{0, time.Hour, expired, http.StatusForbidden},
+		{time.Hour, 3 * time.Hour, expired, http.StatusNoContent},
+	} {
+		web.config.Set(config.Config{SignatureMaxAge: c.configAge})
+		site.SignMaxAge = c.siteAge
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/top/?"+c.query, nil)
+		req.AddCookie(&http.Cookie{Name: "sess", Value: "visitor"})
+		handler(rec, req)
+		if rec.Code != c.status {
+			t.Errorf("max age %v/%v %s: expected %d, got %d", c.configAge, c.siteAge, c.query, c.status, rec.Code)
+		}
+	}
+}
+
+func TestCounterFormat(t *testing.T) {
+	web := newTestWeb(t)
+	handler := web.ErrHandler(web.TopServer)
+
+	for _, c := range []struct {
+		query, accept, contentType string
+	}{
+		{"id=2", "", "image/png"},
+		{"id=2&format=svg", "", "image/svg+xml"},
+		{"id=2", "image/svg+xml", "image/svg+xml"},
+		{"id=2&format=png", "image/svg+xml", "image/png"},
+		{"id=100&format=svg", "", "image/svg+xml"},
+	} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/top/?"+c.query, nil)
+		req.AddCookie(&http.Cookie{Name: "sess", Value: "visitor"})
+		if c.accept != "" {
+			req.Header.Set("Accept", c.accept)
+		}
+		handler(rec, req)
+		if ct := rec.Header().Get("Content-Type"); rec.Code != http.StatusOK || ct != c.contentType {
+			t.Errorf("%s %s: unexpected response %d %s", c.query, c.accept, rec.Code, ct)
+		}
+		if _, ok := req.URL.Query()["format"]; !ok && rec.Header().Get("Vary") != "Accept" {
+			t.Errorf("%s: Vary header is missing", c.query)
+		}
+	}
+}
+
+func TestUnknownSiteCounter(t *testing.T) {
+	web := newTestWeb(t)
+	handler := web.ErrHandler(web.TopServer)
+	images, err := image.NewImages("counters/m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/top/?id=100&format=png", nil))
+		return rec
+	}
+
+	lowest := request()
+	if lowest.Code != http.StatusOK || lowest.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("unexpected response %d", lowest.Code)
+	}
+	web.config.Set(config.Config{DefaultCounter: 2})
+	if rec := request(); rec.Code != http.StatusOK || bytes.Equal(rec.Body.Bytes(), lowest.Body.Bytes()) {
+		t.Errorf("configured default counter is not used: %d", rec.Code)
+	}
+
+	web.config.update(func(state *liveState) {
+		state.images = image.ImageList{3: images[3], 4: images[4]}
+	})
+	if rec := request(); rec.Code != http.StatusOK {
+		t.Errorf("no fallback to the lowest loaded counter: %d", rec.Code)
+	}
+	web.config.update(func(state *liveState) {
+		state.images = image.ImageList{}
+	})
+	if rec := request(); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 without counters, got %d", rec.Code)
+	}
+}